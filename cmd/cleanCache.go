@@ -16,13 +16,18 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/afero"
 
 	"github.com/dpastoor/goutils"
+	"github.com/metrumresearchgroup/pkgr/cran"
+	"github.com/metrumresearchgroup/pkgr/gpsr"
+	"github.com/metrumresearchgroup/pkgr/rcmd"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -31,6 +36,8 @@ import (
 var srcOnly bool
 var binariesOnly bool
 var reposToClear string
+var maxCacheSize string
+var olderThan string
 
 // cacheCmd represents the cache command
 var cleanCacheCmd = &cobra.Command{
@@ -42,6 +49,9 @@ var cleanCacheCmd = &cobra.Command{
 	--src and --binary options to specify which repos to clean each
 	file type from.
 
+	Use --max-size and --older-than to instead remove only the least
+	recently used packages, keeping those of the current plan.
+
 	`,
 	RunE: cache,
 }
@@ -51,17 +61,73 @@ func init() {
 	cleanCacheCmd.Flags().BoolVar(&srcOnly, "src-only", false, "Clean only src files from the cache")
 	cleanCacheCmd.Flags().BoolVar(&binariesOnly, "binaries-only", false, "Clean only binary files from the cache")
 	cleanCacheCmd.Flags().StringVar(&reposToClear, "repos", "ALL", "Comma separated list of repositories to be cleaned. Defaults to all.")
+	cleanCacheCmd.Flags().StringVar(&maxCacheSize, "max-size", "", "Remove the least recently used packages until the cache is within the size, such as 20G")
+	cleanCacheCmd.Flags().StringVar(&olderThan, "older-than", "", "Remove the packages not used within the duration, such as 30d")
 
 	CleanCmd.AddCommand(cleanCacheCmd)
 }
 
 func cache(cmd *cobra.Command, args []string) error {
+	if maxCacheSize != "" || olderThan != "" {
+		return cleanCacheGarbage()
+	}
 	cleanCacheFolders()
 	return nil
 }
 
+// cleanCacheGarbage removes the least recently used packages from the cache,
+// keeping those referenced by the current plan
+func cleanCacheGarbage() error {
+	if srcOnly || binariesOnly || reposToClear != "ALL" {
+		return errors.New("--max-size and --older-than apply to the whole cache and cannot be combined with --src-only, --binaries-only or --repos")
+	}
+	var opts cran.CacheGCOptions
+	var err error
+	if maxCacheSize != "" {
+		if opts.MaxSize, err = cran.ParseSize(maxCacheSize); err != nil {
+			return err
+		}
+	}
+	if olderThan != "" {
+		if opts.OlderThan, err = cran.ParseAge(olderThan); err != nil {
+			return err
+		}
+	}
+	rs := rcmd.NewRSettings(cfg.RPath)
+	_, installPlan, _ := planInstall(rcmd.GetRVersion(&rs), cran.LocalPlatform(), false)
+	opts.Protected = planPackages(installPlan)
+	return collectCacheGarbage(userCache(cfg.Cache.Dir), opts)
+}
+
+// planPackages provides the <package>_<version> of each package downloaded by the plan
+func planPackages(plan gpsr.InstallPlan) map[string]bool {
+	pkgs := make(map[string]bool)
+	for _, d := range plan.PackageDownloads {
+		pkgs[fmt.Sprintf("%s_%s", d.Package.Package, d.Package.Version)] = true
+	}
+	return pkgs
+}
+
+// collectCacheGarbage removes the least recently used packages from the package cache
+func collectCacheGarbage(cacheDir string, opts cran.CacheGCOptions) error {
+	res, err := cran.CollectCacheGarbage(cacheDir, opts, time.Now())
+	fields := log.Fields{
+		"dir":       cacheDir,
+		"removed":   res.Removed,
+		"freed":     fmt.Sprintf("%.2f MB", float64(res.Freed)/(1024*1024)),
+		"size":      fmt.Sprintf("%.2f MB", float64(res.Size)/(1024*1024)),
+		"protected": len(opts.Protected),
+	}
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("error removing least recently used packages from the cache")
+		return err
+	}
+	log.WithFields(fields).Info("removed least recently used packages from the cache")
+	return nil
+}
+
 func cleanCacheFolders() error {
-	cachePath := userCache(cfg.Cache)
+	cachePath := userCache(cfg.Cache.Dir)
 	var repos []string // make empty
 	if reposToClear != "ALL" {
 		repos = strings.Split(reposToClear, ",")
@@ -93,6 +159,14 @@ func cleanCacheFolders() error {
 		return errors.New("'what? that's impossible! my logic is flawless!'")
 	}
 
+	// the package store only keeps files still linked from the repos left in the cache
+	pruned, err := cran.NewPackageStore(fs, cachePath).Prune()
+	if err != nil {
+		log.WithField("error", err).Warn("error pruning the package store")
+	} else {
+		log.WithField("files", pruned).Info("pruned unreferenced files from the package store")
+	}
+
 	// Clear the tarballs
 	log.Info("clearing unpacked tarballs from the cache")
 	for _, tgzFile := range cfg.Tarballs {
@@ -108,7 +182,7 @@ func cleanCacheFolders() error {
 			continue
 		}
 		openedTgz.Close()
-		err = fs.RemoveAll(filepath.Join(cfg.Cache, hashedDirectoryName))
+		err = fs.RemoveAll(filepath.Join(cfg.Cache.Dir, hashedDirectoryName))
 		if err != nil {
 			log.WithFields(log.Fields{
 				"file":  tgzFile,
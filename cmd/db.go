@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/cran"
+	"github.com/spf13/cobra"
+)
+
+// dbCmd inspects the cached repo databases
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "inspect the cached repo databases",
+	Long: `inspect the package indexes cached for each repo, R version and platform,
+	which are reused for up to R_AVAILABLE_PACKAGES_CACHE_CONTROL_MAX_AGE seconds (default 3600)`,
+}
+
+var dbListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the cached repo databases and their age",
+	Args:  cobra.NoArgs,
+	RunE:  dbList,
+}
+
+var dbShowCmd = &cobra.Command{
+	Use:   "show <repo>",
+	Short: "show the details of the cached databases of a repo",
+	Args:  cobra.ExactArgs(1),
+	RunE:  dbShow,
+}
+
+func init() {
+	dbCmd.AddCommand(dbListCmd)
+	dbCmd.AddCommand(dbShowCmd)
+	RootCmd.AddCommand(dbCmd)
+}
+
+func dbList(cmd *cobra.Command, args []string) error {
+	caches, err := cran.ListRepoDbCaches(cran.RepoDbCacheDir())
+	if err != nil {
+		return err
+	}
+	if len(caches) == 0 {
+		fmt.Println("no cached repo databases in", cran.RepoDbCacheDir())
+		return nil
+	}
+	return cran.WriteRepoDbCaches(os.Stdout, caches, time.Now())
+}
+
+func dbShow(cmd *cobra.Command, args []string) error {
+	caches, err := cran.ListRepoDbCaches(cran.RepoDbCacheDir())
+	if err != nil {
+		return err
+	}
+	found := 0
+	for _, c := range caches {
+		// the cache file name identifies caches which cannot be read
+		if c.Header.Repo != args[0] && filepath.Base(c.File) != args[0] {
+			continue
+		}
+		if found > 0 {
+			fmt.Println()
+		}
+		if err := cran.WriteRepoDbCache(os.Stdout, c, time.Now()); err != nil {
+			return err
+		}
+		found++
+	}
+	if found == 0 {
+		return fmt.Errorf("no cached repo database for %s in %s", args[0], cran.RepoDbCacheDir())
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/metrumresearchgroup/pkgr/logger"
 
+	"github.com/metrumresearchgroup/pkgr/cran"
 	"github.com/metrumresearchgroup/pkgr/gpsr"
 	"github.com/metrumresearchgroup/pkgr/pacman"
 	"github.com/metrumresearchgroup/pkgr/rcmd"
@@ -41,6 +42,7 @@ var showDeps bool
 var toJson bool
 var tree bool
 var installedFrom bool
+var showVersions bool
 
 func recurseDeps(pkg string, ddb gpsr.InstallPlan, t treeprint.Tree) {
 	pkgDeps := ddb.DepDb[pkg]
@@ -68,7 +70,20 @@ func inspect(cmd *cobra.Command, args []string) error {
 
 	rs := rcmd.NewRSettings(cfg.RPath)
 	rVersion := rcmd.GetRVersion(&rs)
-	_, ip, _ := planInstall(rVersion, true)
+	pkgNexus, ip, _ := planInstall(rVersion, cran.LocalPlatform(), true)
+	if showVersions {
+		pkgs := args
+		if len(pkgs) == 0 {
+			for _, pkg := range ip.PackageDownloads {
+				pkgs = append(pkgs, pkg.Package.Package)
+			}
+		}
+		versions := make(map[string]map[string][]string)
+		for _, pkg := range pkgs {
+			versions[pkg] = pkgNexus.GetVersionsByRepo(pkg)
+		}
+		prettyPrint(versions)
+	}
 	if showDeps {
 		var allDeps map[string][]string
 		keepDeps := make(map[string][]string)
@@ -112,6 +127,7 @@ func init() {
 	inspectCmd.Flags().BoolVar(&tree, "tree", false, "show full recursive dependency tree")
 	inspectCmd.Flags().BoolVar(&toJson, "json", false, "output as clean json")
 	inspectCmd.Flags().BoolVar(&installedFrom, "installed-from", false, "show package installation source")
+	inspectCmd.Flags().BoolVar(&showVersions, "versions", false, "show every available version of packages per repo")
 
 	RootCmd.AddCommand(inspectCmd)
 }
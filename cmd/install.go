@@ -57,7 +57,8 @@ func rInstall(cmd *cobra.Command, args []string) error {
 
 	// Get master object containing the packages available in each repository (pkgNexus),
 	//  as well as a master install plan to guide our process.
-	_, installPlan, rollbackPlan := planInstall(rVersion, true)
+	platform := cran.LocalPlatform()
+	_, installPlan, rollbackPlan := planInstall(rVersion, platform, true)
 
 	if installPlan.CreateLibrary {
 		if cfg.Strict {
@@ -85,10 +86,10 @@ func rInstall(cmd *cobra.Command, args []string) error {
 	//pkgsToDownload := getPackagesToDownload(installPlan, pkgNexus)
 
 	// Retrieve a cache to store any packages we need to download for the install.
-	packageCache := rcmd.NewPackageCache(userCache(cfg.Cache), false)
+	packageCache := rcmd.NewPackageCache(userCache(cfg.Cache.Dir), false)
 
 	//Create a pkgMap object, which helps us with parallel downloads (?)
-	pkgMap, err := cran.DownloadPackages(fs, installPlan.PackageDownloads, packageCache.BaseDir, rVersion, cfg.NoSecure)
+	pkgMap, err := cran.DownloadPackages(fs, installPlan.PackageDownloads, packageCache.BaseDir, rVersion, platform, cfg.NoSecure, cfg.SkipVerify, cfg.Offline)
 	if err != nil {
 		log.Fatalf("error downloading packages: %s", err)
 	}
@@ -121,7 +122,7 @@ func rInstall(cmd *cobra.Command, args []string) error {
 	//
 	// Install the tarballs, if applicable.
 	//
-	errInstallAdditional := installAdditionalPackages(installPlan, rSettings, cfg.Library, cfg.Cache)
+	errInstallAdditional := installAdditionalPackages(installPlan, rSettings, cfg.Library, cfg.Cache.Dir)
 
 	log.WithField("duration", time.Since(startTime)).Info("total package install time")
 
@@ -138,6 +139,15 @@ func rInstall(cmd *cobra.Command, args []string) error {
 	// Errors are handled in the lower functions
 	_ = rollbackPlan.DeleteBackupPackageFolders(fs)
 
+	if cfg.Cache.MaxSize != "" {
+		// validated when loading the config
+		maxSize, _ := cran.ParseSize(cfg.Cache.MaxSize)
+		_ = collectCacheGarbage(packageCache.BaseDir, cran.CacheGCOptions{
+			MaxSize:   maxSize,
+			Protected: planPackages(installPlan),
+		})
+	}
+
 	log.Info("duration:", time.Since(startTime))
 
 	if err != nil {
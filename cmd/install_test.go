@@ -66,7 +66,7 @@ func InitGlobalConfig(libraryPath, localRepo string, update, suggests bool, inst
 		Library:  libraryPath,
 		Version:  1,
 		//Logging: configlib.LogConfig{Level: "debug"}, // Controlled before cfg unmarshalling, I think
-		Cache: "./testsite/working/localcache",
+		Cache: configlib.CacheConfig{Dir: "./testsite/working/localcache"},
 		Customizations: configlib.Customizations{
 			Repos: []map[string]configlib.RepoConfig{{
 				"testRepo": configlib.RepoConfig{
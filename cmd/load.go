@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"github.com/metrumresearchgroup/pkgr/cran"
 	"github.com/metrumresearchgroup/pkgr/logger"
 	"github.com/metrumresearchgroup/pkgr/rcmd"
 	"github.com/metrumresearchgroup/pkgr/rcmd/rp"
@@ -74,7 +75,7 @@ func load(userPackages []string, rs rcmd.RSettings, rDir string, threads int, al
 	log.Info("getting relevant packages via `pkgr plan`..................")
 
 	rVersion := rcmd.GetRVersion(&rs)
-	_, installPlan, _ := planInstall(rVersion, false)
+	_, installPlan, _ := planInstall(rVersion, cran.LocalPlatform(), false)
 
 	log.Info("finished getting packages from `pkgr plan`__________________")
 
@@ -52,29 +52,100 @@ var planCmd = &cobra.Command{
 	RunE: plan,
 }
 
+var targetRVersion string
+var targetPlatform string
+var targetDistro string
+var downloadPlan bool
+
 func init() {
 	planCmd.PersistentFlags().Bool("show-deps", false, "show the (required) dependencies for each package")
 	viper.BindPFlag("show-deps", planCmd.PersistentFlags().Lookup("show-deps"))
+	planCmd.Flags().StringVar(&targetRVersion, "r-version", "", "plan for this version of R, eg 4.2.1, rather than the installed R")
+	planCmd.Flags().StringVar(&targetPlatform, "platform", "", "plan for this R platform, eg x86_64-pc-linux-gnu, rather than the running platform")
+	planCmd.Flags().StringVar(&targetDistro, "distro", "", "plan for this linux distribution, eg jammy or rhel9, rather than the running distribution")
+	planCmd.Flags().BoolVar(&downloadPlan, "download", false, "download the packages of the plan to the package cache, eg to install offline on a system of the target R version and platform")
 	RootCmd.AddCommand(planCmd)
 }
 
 func plan(cmd *cobra.Command, args []string) error {
 	log.Infof("Installation would launch %v workers\n", getWorkerCount(cfg.Threads, runtime.NumCPU()))
-	rs := rcmd.NewRSettings(cfg.RPath)
-	rVersion := rcmd.GetRVersion(&rs)
+	rVersion, platform := planTarget()
+	if planForTarget() {
+		// the installed packages compared against are those of the library for the target
+		configlib.SetLockfileLibrary(&cfg, rVersion, targetRPlatform(platform))
+	}
 	log.Infoln("R Version " + rVersion.ToFullString())
-	log.Infoln("OS Platform " + rs.Platform)
-	_, ip, _ := planInstall(rVersion, true)
+	log.Infoln("OS Platform " + platform.String())
+	_, ip, _ := planInstall(rVersion, platform, true)
 	if viper.GetBool("show-deps") {
 		for pkg, deps := range ip.DepDb {
 			fmt.Println("-----------  ", pkg, "   ------------")
 			fmt.Println(deps)
 		}
 	}
+	if downloadPlan {
+		// packages are only downloaded, as they can not be installed by an R of another version or platform
+		packageCache := rcmd.NewPackageCache(userCache(cfg.Cache.Dir), false)
+		if _, err := cran.DownloadPackages(fs, ip.PackageDownloads, packageCache.BaseDir, rVersion, platform, cfg.NoSecure, cfg.SkipVerify, cfg.Offline); err != nil {
+			log.Fatalf("error downloading packages: %s", err)
+		}
+	}
 	return nil
 }
 
-func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.InstallPlan, rollback.RollbackPlan) {
+// planTarget provides the R version and platform to plan for, only running R
+// when no --r-version is given, so plans can be made for systems yet to be built
+func planTarget() (cran.RVersion, cran.Platform) {
+	var rVersion cran.RVersion
+	if targetRVersion != "" {
+		rv, err := cran.ParseRVersion(targetRVersion)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rVersion = rv
+	} else {
+		rs := rcmd.NewRSettings(cfg.RPath)
+		rVersion = rcmd.GetRVersion(&rs)
+	}
+	platform := cran.LocalPlatform()
+	if targetPlatform != "" {
+		p, err := cran.ParsePlatform(targetPlatform)
+		if err != nil {
+			log.Fatal(err)
+		}
+		platform = p
+	}
+	if targetDistro != "" {
+		if platform.OS != "linux" {
+			log.WithField("platform", platform.String()).Fatal("--distro is only supported for linux platforms")
+		}
+		distro, err := cran.ParseDistro(targetDistro)
+		if err != nil {
+			log.Fatal(err)
+		}
+		platform.Distro = distro
+	} else if targetPlatform != "" && platform.OS == "linux" {
+		log.WithField("platform", platform.String()).Warn("no --distro given, linux binaries will not be used")
+	}
+	return rVersion, platform
+}
+
+// planForTarget provides whether the plan is for a target R version or platform
+// given with --r-version or --platform, rather than the installed R
+func planForTarget() bool {
+	return targetRVersion != "" || targetPlatform != ""
+}
+
+// targetRPlatform provides the R platform of the target, as given with --platform
+func targetRPlatform(p cran.Platform) string {
+	if targetPlatform != "" {
+		return targetPlatform
+	}
+	return p.String()
+}
+
+// planInstall plans the installation for the R version rv on platform p
+func planInstall(rv cran.RVersion, p cran.Platform, exitOnMissing bool) (*cran.PkgNexus, gpsr.InstallPlan, rollback.RollbackPlan) {
 	startTime := time.Now()
 
 	//Check library existence
@@ -93,13 +164,11 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 		}).Error("library directory must exist before running pkgr in strict mode")
 	}
 
-	var installedPackageNames []string
 	var installedPackages map[string]desc.Desc
 	var whereInstalledFrom pacman.InstalledFromPkgs
 
 	if libraryExists {
 		installedPackages = pacman.GetPriorInstalledPackages(fs, cfg.Library)
-		installedPackageNames = extractNamesFromDesc(installedPackages)
 		log.WithField("count", len(installedPackages)).Info("found installed packages")
 		whereInstalledFrom = pacman.GetInstallers(installedPackages)
 		notPkgr := whereInstalledFrom.NotFromPkgr()
@@ -117,43 +186,22 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 		//fs.Chmod(cfg.Library, 0755)
 	}
 
-	var repos []cran.RepoURL
-	for _, r := range cfg.Repos {
-		for nm, url := range r {
-			repo, _ := configlib.GetRepoCustomizationByName(nm, cfg.Customizations)
-			// for now no need to check if customization exists as the repo will have a default empty string
-			// regardless so no additional logic needed
-			repos = append(repos, cran.RepoURL{Name: nm, URL: url, Suffix: repo.RepoSuffix})
-		}
-	}
-	st := cran.DefaultType()
-	cic := cran.NewInstallConfig()
-	for _, repoSlice := range cfg.Customizations.Repos {
-		for rn, val := range repoSlice {
-			rc := cran.RepoConfig{}
-			if strings.EqualFold(val.RepoType, "MPN") {
-				rc.RepoType = cran.MPN
-				rc.DefaultSourceType = cran.Binary
-			}
-			if strings.EqualFold(val.RepoType, "RSPM") {
-				rc.RepoType = cran.RSPM
-			}
-			if strings.EqualFold(val.Type, "binary") {
-				rc.DefaultSourceType = cran.Binary
-			}
-			if strings.EqualFold(val.Type, "source") {
-				rc.DefaultSourceType = cran.Source
-			}
-			if val.RepoSuffix != "" {
-				rc.RepoSuffix = val.RepoSuffix
-			}
-			cic.Repos[rn] = rc
-		}
+	repos := buildRepos(cfg, rv)
+	st := cran.DefaultType(p)
+	cic := buildInstallConfig(cfg, p, repos)
+	if cfg.NoSecure {
+		log.Warn("TLS certificate verification is disabled for all repos, consider setting a CACert for the repo instead")
 	}
 	pkgNexus, err := cran.NewPkgDb(repos, st, cic, rv, cfg.NoSecure)
 	if err != nil {
+		if cfg.Offline {
+			log.Fatalf("error getting pkgdb: %s", err)
+		}
 		log.Panicln("error getting pkgdb ", err)
 	}
+	// archived versions read while resolving are kept in the package cache for installation
+	pkgNexus.PackageCache = rcmd.NewPackageCache(userCache(cfg.Cache.Dir), false).BaseDir
+	pkgNexus.Fs = fs
 	log.Infoln("Default package installation type: ", st.String())
 	for _, db := range pkgNexus.Db {
 		log.Infoln(fmt.Sprintf("%v:%v (binary:source) packages available in for %s from %s", len(db.DescriptionsBySourceType[cran.Binary]), len(db.DescriptionsBySourceType[cran.Source]), db.Repo.Name, db.Repo.URL))
@@ -165,7 +213,7 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 			delete(db.DescriptionsBySourceType[cran.Source], pkg)
 		}
 	}
-	log.Infoln("Package installation cache directory: ", userCache(cfg.Cache))
+	log.Infoln("Package installation cache directory: ", userCache(cfg.Cache.Dir))
 	log.Infoln("Database cache directory: ", filepath.Dir(pkgNexus.Db[0].GetRepoDbCacheFilePath(rv.ToFullString())))
 
 
@@ -178,7 +226,7 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 	var unpackedTarballPkgs map[string]gpsr.AdditionalPkg
 
 	if len(cfg.Tarballs) > 0 {
-		tarballDescriptions, unpackedTarballPkgs = unpackTarballs(fs, cfg.Tarballs, cfg.Cache)
+		tarballDescriptions, unpackedTarballPkgs = unpackTarballs(fs, cfg.Tarballs, cfg.Cache.Dir)
 		for _, tarballDesc := range tarballDescriptions {
 			tarballDeps := tarballDesc.GetCombinedDependencies(false)
 			for _, d := range tarballDeps {
@@ -208,9 +256,26 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 
 	cfg.Packages = removeBasePackages(cfg.Packages)
 
+	// user packages with no current version satisfying their pins or the R version
+	// may still be installed from the archive of the repo
+	for _, p := range cfg.Packages {
+		if _, _, found := pkgNexus.GetPackage(p); !found {
+			pkgNexus.ResolveArchivedPackage(p)
+		}
+	}
 	availableUserPackages := pkgNexus.GetPackages(cfg.Packages)
-	if len(availableUserPackages.Missing) > 0 {
-		log.Errorln("missing packages: ", availableUserPackages.Missing)
+	pinsSatisfied := checkPackagePins(pkgNexus, cfg.PackagePins)
+	// packages with a pin no repo satisfies are reported above rather than as missing
+	var missingPackages []string
+	for _, mp := range availableUserPackages.Missing {
+		if pkgNexus.CheckConstraints(mp) == nil {
+			missingPackages = append(missingPackages, mp)
+		}
+	}
+	if len(missingPackages) > 0 || !pinsSatisfied {
+		if len(missingPackages) > 0 {
+			log.Errorln("missing packages: ", missingPackages)
+		}
 		model := fuzzy.NewModel()
 
 		// For testing only, this is not advisable on production
@@ -221,7 +286,7 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 		model.SetDepth(1)
 		pkgs := pkgNexus.GetAllPkgsByName()
 		model.Train(pkgs)
-		for _, mp := range availableUserPackages.Missing {
+		for _, mp := range missingPackages {
 			log.Warnln("did you mean one of: ", model.Suggestions(mp, false))
 		}
 		if exitOnMissing {
@@ -242,18 +307,151 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 		libraryExists,
 		cfg.NoRecommended,
 	)
+	if err != nil {
+		log.Fatalf("error resolving installation plan: %s", err)
+	}
 
 	installPlan.AdditionalPackageSources = unpackedTarballPkgs
 
-	logAdditionalPackageOrigins(installPlan.AdditionalPackageSources)
-
 	rollbackPlan := rollback.CreateRollbackPlan(cfg.Library, installPlan, installedPackages)
 
-	if err != nil {
-		fmt.Println(err)
-		panic(err)
+	reportPlan(pkgNexus, installPlan, rv, installedPackages, whereInstalledFrom)
+
+	log.Infoln("resolution time", time.Since(startTime))
+	return pkgNexus, installPlan, rollbackPlan
+}
+
+// buildRepos provides the repos of the config, expanding Bioconductor repos
+// to the release for the R version rv
+func buildRepos(cfg configlib.PkgrConfig, rv cran.RVersion) []cran.RepoURL {
+	var repos []cran.RepoURL
+	for _, r := range cfg.Repos {
+		for nm, url := range r {
+			repo, _ := configlib.GetRepoCustomizationByName(nm, cfg.Customizations)
+			// for now no need to check if customization exists as the repo will have a default empty string
+			// regardless so no additional logic needed
+			auth := cran.RepoAuth{
+				Type:        repo.Auth,
+				Username:    repo.Username,
+				PasswordEnv: repo.PasswordEnv,
+				TokenEnv:    repo.TokenEnv,
+				NetrcFile:   repo.Netrc,
+			}
+			if err := auth.Validate(); err != nil {
+				log.WithField("repo", nm).Fatal(err)
+			}
+			repoTLS := cran.RepoTLS{
+				CACert:     repo.CACert,
+				ClientCert: repo.ClientCert,
+				ClientKey:  repo.ClientKey,
+			}
+			if err := repoTLS.Validate(); err != nil {
+				log.WithField("repo", nm).Fatal(err)
+			}
+			if repo.Snapshot != "" {
+				if !strings.EqualFold(repo.RepoType, "RSPM") {
+					log.WithField("repo", nm).Fatal("Snapshot is only supported for RepoType: RSPM")
+				}
+				snapshotURL, err := cran.RSPMSnapshotURL(url, repo.Snapshot)
+				if err != nil {
+					log.WithField("repo", nm).Fatal(err)
+				}
+				log.WithFields(log.Fields{
+					"repo":     nm,
+					"snapshot": repo.Snapshot,
+					"url":      snapshotURL,
+				}).Info("using repo snapshot")
+				url = snapshotURL
+			}
+			repoURL := cran.RepoURL{Name: nm, URL: url, Suffix: repo.RepoSuffix, Auth: auth, TLS: repoTLS}
+			repoURL.Mirrors = repo.Mirrors
+			if strings.EqualFold(repo.RepoType, "bioconductor") {
+				biocRepos, biocVersion, err := cran.ExpandBioconductorRepo(repoURL, repo.BiocVersion, rv)
+				if err != nil {
+					log.WithField("repo", nm).Fatal(err)
+				}
+				log.WithFields(log.Fields{
+					"repo":         nm,
+					"bioc_version": biocVersion,
+					"r_version":    rv.ToString(),
+				}).Info("using Bioconductor release")
+				for _, br := range biocRepos {
+					log.WithFields(log.Fields{
+						"repo": br.Name,
+						"url":  br.URL,
+					}).Info("Bioconductor repo")
+				}
+				repos = append(repos, biocRepos...)
+				continue
+			}
+			repos = append(repos, repoURL)
+		}
 	}
+	return repos
+}
+
+// buildInstallConfig provides the install settings of the config for platform p,
+// with the settings of each repo shared by the repos expanded from it
+func buildInstallConfig(cfg configlib.PkgrConfig, p cran.Platform, repos []cran.RepoURL) *cran.InstallConfig {
+	cic := cran.NewInstallConfig()
+	cic.Platform = p
+	cic.Offline = cfg.Offline
+	cic.NewerSource = cfg.NewerSource
+	if cfg.Offline {
+		log.Info("offline mode, only using cached repo information and packages")
+	}
+	for _, repoSlice := range cfg.Customizations.Repos {
+		for rn, val := range repoSlice {
+			rc := cran.RepoConfig{}
+			if strings.EqualFold(val.RepoType, "MPN") {
+				rc.RepoType = cran.MPN
+				rc.DefaultSourceType = cran.Binary
+			}
+			if strings.EqualFold(val.RepoType, "RSPM") {
+				rc.RepoType = cran.RSPM
+			}
+			if strings.EqualFold(val.RepoType, "bioconductor") {
+				rc.RepoType = cran.BIOCONDUCTOR
+			}
+			if strings.EqualFold(val.Type, "binary") {
+				rc.DefaultSourceType = cran.Binary
+			}
+			if strings.EqualFold(val.Type, "source") {
+				rc.DefaultSourceType = cran.Source
+			}
+			if strings.EqualFold(val.Type, "both") {
+				rc.DefaultSourceType = cran.Both
+			}
+			if val.RepoSuffix != "" {
+				rc.RepoSuffix = val.RepoSuffix
+			}
+			rc.Include = val.Include
+			rc.Exclude = val.Exclude
+			if err := rc.Validate(); err != nil {
+				log.WithField("repo", rn).Fatal(err)
+			}
+			cic.Repos[rn] = rc
+			// repos expanded from this one share its settings
+			for _, r := range repos {
+				if r.Group == rn {
+					cic.Repos[r.Name] = rc
+				}
+			}
+		}
+	}
+	return cic
+}
+
+// reportPlan logs where the packages of the plan come from and what is to be installed or updated,
+// exiting when StrictRepos is set and packages available from multiple repos are not pinned
+func reportPlan(pkgNexus *cran.PkgNexus, installPlan gpsr.InstallPlan, rv cran.RVersion, installedPackages map[string]desc.Desc, whereInstalledFrom pacman.InstalledFromPkgs) {
+	installedPackageNames := extractNamesFromDesc(installedPackages)
+	logAdditionalPackageOrigins(installPlan.AdditionalPackageSources)
+
 	logDependencyRepos(installPlan.PackageDownloads)
+	logPackageTypes(installPlan.PackageDownloads)
+	logRVersionDowngrades(pkgNexus, installPlan.PackageDownloads, rv)
+	checkRepoCollisions(pkgNexus, installPlan.PackageDownloads)
 
 	pkgs := installPlan.GetAllPackages()
 
@@ -315,9 +513,54 @@ func planInstall(rv cran.RVersion, exitOnMissing bool) (*cran.PkgNexus, gpsr.Ins
 			}
 		}
 	}
+}
 
-	log.Infoln("resolution time", time.Since(startTime))
-	return pkgNexus, installPlan, rollbackPlan
+// checkRepoCollisions reports the packages of the plan that more than one repo could provide.
+// With StrictRepos, each must have its repo set with a Repo customization, as otherwise
+// a package published to an earlier repo would silently take its place
+func checkRepoCollisions(pkgNexus *cran.PkgNexus, packageDownloads []cran.PkgDl) {
+	var pkgs []string
+	for _, pkgdl := range packageDownloads {
+		pkgs = append(pkgs, pkgdl.Package.Package)
+	}
+	collisions := pkgNexus.FindCollisions(pkgs)
+	if len(collisions) == 0 {
+		return
+	}
+	fmt.Println("packages available from multiple repos (* marks the repo used):")
+	_ = cran.WriteCollisions(os.Stdout, collisions)
+	var unpinned []string
+	for _, c := range collisions {
+		if !c.Pinned {
+			unpinned = append(unpinned, c.Package)
+		}
+	}
+	if len(unpinned) == 0 {
+		return
+	}
+	fields := log.Fields{"packages": unpinned}
+	if cfg.StrictRepos {
+		log.WithFields(fields).Fatal("packages available from multiple repos must have their repo set with a Repo customization with StrictRepos")
+	}
+	log.WithFields(fields).Warn("packages available from multiple repos, set their repo with a Repo customization or restrict repos with Include/Exclude")
+}
+
+// checkPackagePins logs every pinned package that no configured repo can provide
+// a satisfying version for, returning whether all pins can be satisfied
+func checkPackagePins(pkgNexus *cran.PkgNexus, pins []desc.Dep) bool {
+	satisfied := true
+	checked := make(map[string]bool)
+	for _, pin := range pins {
+		if checked[pin.Name] {
+			continue
+		}
+		checked[pin.Name] = true
+		if err := pkgNexus.CheckConstraints(pin.Name); err != nil {
+			log.WithField("pkg", pin.Name).Error(err)
+			satisfied = false
+		}
+	}
+	return satisfied
 }
 
 // Removes any "base" packages from the given list.
@@ -347,6 +590,40 @@ func logAdditionalPackageOrigins(additionalPackages map[string]gpsr.AdditionalPk
 	}
 }
 
+// logPackageTypes logs the type chosen for each package of Type: both, and why
+func logPackageTypes(packageDownloads []cran.PkgDl) {
+	for _, pkgdl := range packageDownloads {
+		if pkgdl.Config.Reason == "" {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"pkg":     pkgdl.Package.Package,
+			"repo":    pkgdl.Config.Repo.Name,
+			"version": pkgdl.Package.Version,
+			"type":    pkgdl.Config.Type,
+			"reason":  pkgdl.Config.Reason,
+		}).Info("package type chosen")
+	}
+}
+
+// logRVersionDowngrades logs each package for which an older version was selected
+// as the newer versions available require a newer version of R
+func logRVersionDowngrades(pkgNexus *cran.PkgNexus, packageDownloads []cran.PkgDl, rv cran.RVersion) {
+	for _, pkgdl := range packageDownloads {
+		newer, ok := pkgNexus.RVersionDowngrade(pkgdl.Package.Package, pkgdl.Package)
+		if !ok {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"pkg":       pkgdl.Package.Package,
+			"repo":      pkgdl.Config.Repo.Name,
+			"version":   pkgdl.Package.Version,
+			"newer":     newer,
+			"r_version": rv.ToFullString(),
+		}).Warn("older version selected as newer versions require a newer R version")
+	}
+}
+
 func logUserPackageRepos(packageDownloads []cran.PkgDl) {
 	for _, pkg := range packageDownloads {
 		log.WithFields(log.Fields{
@@ -93,9 +93,18 @@ func rootInit() {
 	RootCmd.PersistentFlags().Bool("rollback", cfg.Rollback, "Enable rollback")
 	_ = viper.BindPFlag("rollback", RootCmd.PersistentFlags().Lookup("rollback"))
 
-	RootCmd.PersistentFlags().Bool("no-secure", cfg.Rollback, "disable TLS certificate verification")
+	RootCmd.PersistentFlags().Bool("no-secure", cfg.Rollback, "disable TLS certificate verification for all repos, prefer setting a CACert for the repo instead")
 	_ = viper.BindPFlag("nosecure", RootCmd.PersistentFlags().Lookup("no-secure"))
 
+	RootCmd.PersistentFlags().Bool("skip-verify", cfg.SkipVerify, "skip verifying downloaded packages against repository checksums")
+	_ = viper.BindPFlag("skipverify", RootCmd.PersistentFlags().Lookup("skip-verify"))
+
+	RootCmd.PersistentFlags().Bool("offline", cfg.Offline, "only use the cached repo information and packages, never querying repos")
+	_ = viper.BindPFlag("offline", RootCmd.PersistentFlags().Lookup("offline"))
+
+	RootCmd.PersistentFlags().Bool("strict-repos", cfg.StrictRepos, "refuse to install packages available from multiple repos unless their repo is set with a Repo customization")
+	_ = viper.BindPFlag("strictrepos", RootCmd.PersistentFlags().Lookup("strict-repos"))
+
 	RootCmd.PersistentFlags().Bool("strict", cfg.Strict, "Enable strict mode")
 	_ = viper.BindPFlag("strict", RootCmd.PersistentFlags().Lookup("strict"))
 }
@@ -119,7 +128,12 @@ func initConfig() {
 	}
 
 	log.Trace("attempting to load config file")
-	configlib.NewConfig(viper.GetString("config"), &cfg)
+	if planForTarget() {
+		// the library is set for the target R version and platform by plan, without running R
+		configlib.LoadConfig(viper.GetString("config"), &cfg)
+	} else {
+		configlib.NewConfig(viper.GetString("config"), &cfg)
+	}
 
 	configFilePath, _ := filepath.Abs(viper.ConfigFileUsed())
 	cwd, _ := os.Getwd()
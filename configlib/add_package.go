@@ -34,8 +34,13 @@ func AddPackages(pkgs []string) error {
 		return err
 	}
 
+	// compare by name so a pinned entry such as dplyr (== 1.0.7) is not duplicated
+	existingPkgs, _, err := splitPackagePins(pc.Packages, Customizations{})
+	if err != nil {
+		return err
+	}
 	for _, p := range pkgs {
-		if funk.ContainsString(pc.Packages, p) {
+		if funk.ContainsString(existingPkgs, p) {
 			log.Debug(fmt.Sprintf("Package <%s> already found in <%s>", p, ymlfile))
 			continue
 		}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/metrumresearchgroup/pkgr/cran"
 	"github.com/metrumresearchgroup/pkgr/gpsr"
@@ -28,8 +29,20 @@ func packratPlatform(p string) string {
 	}
 }
 
-// NewConfig initialize a PkgrConfig passed in by caller
+// NewConfig initialize a PkgrConfig passed in by caller, setting the Library of the
+// Lockfile for the installed R when no Library is set
 func NewConfig(cfgPath string, cfg *PkgrConfig) {
+	LoadConfig(cfgPath, cfg)
+	if len(cfg.Library) == 0 {
+		rs := rcmd.NewRSettings(cfg.RPath)
+		rVersion := rcmd.GetRVersion(&rs)
+		SetLockfileLibrary(cfg, rVersion, rs.Platform)
+	}
+}
+
+// LoadConfig initialize a PkgrConfig passed in by caller without setting the Library,
+// for when it is for an R version or platform other than the installed R, see SetLockfileLibrary
+func LoadConfig(cfgPath string, cfg *PkgrConfig) {
 	err := loadConfigFromPath(cfgPath)
 	if err != nil {
 		log.Fatal("could not detect config at supplied path: " + cfgPath)
@@ -38,11 +51,13 @@ func NewConfig(cfgPath string, cfg *PkgrConfig) {
 	if err != nil {
 		log.Fatalf("error parsing pkgr.yml: %s\n", err)
 	}
-
-	if len(cfg.Library) == 0 {
-		rs := rcmd.NewRSettings(cfg.RPath)
-		rVersion := rcmd.GetRVersion(&rs)
-		cfg.Library = getLibraryPath(cfg.Lockfile.Type, cfg.RPath, rVersion, rs.Platform, cfg.Library)
+	cfg.Cache, err = parseCacheConfig(viper.Get("cache"))
+	if err != nil {
+		log.Fatalf("error parsing Cache in pkgr.yml: %s\n", err)
+	}
+	cfg.Packages, cfg.PackagePins, err = splitPackagePins(cfg.Packages, cfg.Customizations)
+	if err != nil {
+		log.Fatalf("error parsing package versions in pkgr.yml: %s\n", err)
 	}
 
 	// For all cfg	values that can be repos, make sure that ~ is expanded to the home directory.
@@ -53,11 +68,49 @@ func NewConfig(cfgPath string, cfg *PkgrConfig) {
 	cfg.Repos = expandTildesRepos(cfg.Repos)
 	cfg.Logging.All = expandTilde(cfg.Logging.All)
 	cfg.Logging.Install = expandTilde(cfg.Logging.Install)
-	cfg.Cache = expandTilde(cfg.Cache)
+	cfg.Cache.Dir = expandTilde(cfg.Cache.Dir)
 
 	return
 }
 
+// SetLockfileLibrary sets the Library, when none is set, to the library of the Lockfile
+// for the R version and R platform, eg renv/library/R-4.2/x86_64-pc-linux-gnu for renv
+func SetLockfileLibrary(cfg *PkgrConfig, rVersion cran.RVersion, platform string) {
+	if len(cfg.Library) == 0 {
+		cfg.Library = getLibraryPath(cfg.Lockfile.Type, cfg.RPath, rVersion, platform, cfg.Library)
+	}
+}
+
+// parseCacheConfig parses the Cache setting, which is either the cache directory
+// or the settings of the cache
+func parseCacheConfig(value interface{}) (CacheConfig, error) {
+	var c CacheConfig
+	switch v := value.(type) {
+	case nil:
+	case string:
+		c.Dir = v
+	case map[string]interface{}:
+		for k, setting := range v {
+			switch strings.ToLower(k) {
+			case "dir":
+				c.Dir = fmt.Sprint(setting)
+			case "maxsize":
+				c.MaxSize = fmt.Sprint(setting)
+			default:
+				return c, fmt.Errorf("unknown setting %s", k)
+			}
+		}
+	default:
+		return c, fmt.Errorf("expected the cache directory or settings, got %v", v)
+	}
+	if c.MaxSize != "" {
+		if _, err := cran.ParseSize(c.MaxSize); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
 /// expand the ~ at the beginning of a path to the home directory.
 /// consider any problems a fatal error.
 func expandTilde(p string) string {
@@ -168,6 +221,10 @@ func loadDefaultSettings() {
 	viper.SetDefault("strict", false)
 	viper.SetDefault("rollback", true)
 	viper.SetDefault("nosecure", false)
+	viper.SetDefault("skipverify", false)
+	viper.SetDefault("offline", false)
+	viper.SetDefault("strictrepos", false)
+	viper.SetDefault("newersource", false)
 }
 
 // IsCustomizationSet ...
@@ -238,6 +295,12 @@ func SetCustomizations(rSettings rcmd.RSettings, cfg PkgrConfig) rcmd.RSettings
 			}
 		}
 	}
+	for _, repoCustomizations := range cfg.Customizations.Repos {
+		for _, v := range repoCustomizations {
+			auth := cran.RepoAuth{PasswordEnv: v.PasswordEnv, TokenEnv: v.TokenEnv}
+			rSettings.CensoredEnvVars = append(rSettings.CensoredEnvVars, auth.EnvVars()...)
+		}
+	}
 	return rSettings
 }
 
@@ -246,6 +309,10 @@ func SetPlanCustomizations(cfg PkgrConfig, dependencyConfigurations gpsr.Install
 
 	setCfgCustomizations(cfg, &dependencyConfigurations)
 
+	for _, pin := range cfg.PackagePins {
+		pkgNexus.AddConstraint(pin, PinSource)
+	}
+
 	//if viper.Sub("Customizations") != nil && viper.Sub("Customizations").AllSettings()["packages"] != nil {
 	if len(cfg.Customizations.Packages) > 0 {
 		pkgSettings := viper.Sub("Customizations").AllSettings()["packages"].([]interface{})
@@ -555,6 +555,17 @@ func TestGetLibraryPath(t *testing.T) {
 	}
 }
 
+func TestSetLockfileLibrary(t *testing.T) {
+	rv := cran.RVersion{Major: 4, Minor: 2, Patch: 1}
+	cfg := PkgrConfig{Lockfile: Lockfile{Type: "renv"}}
+	SetLockfileLibrary(&cfg, rv, "x86_64-pc-linux-gnu")
+	assert.Equal(t, filepath.Join("renv", "library", "R-4.2", "x86_64-pc-linux-gnu"), cfg.Library)
+
+	cfg = PkgrConfig{Lockfile: Lockfile{Type: "renv"}, Library: "lib"}
+	SetLockfileLibrary(&cfg, rv, "x86_64-pc-linux-gnu")
+	assert.Equal(t, "lib", cfg.Library, "a Library set is kept")
+}
+
 func TestSetCustomizations(t *testing.T) {
 	tests := []struct {
 		pkg   string
@@ -593,6 +604,22 @@ func TestSetCustomizations(t *testing.T) {
 	}
 }
 
+func TestSetCustomizationsRepoCredentials(t *testing.T) {
+	cfg := PkgrConfig{
+		Customizations: Customizations{
+			Repos: []map[string]RepoConfig{
+				{"private": RepoConfig{Auth: "bearer", TokenEnv: "PRIVATE_TOKEN"}},
+				{"internal": RepoConfig{Auth: "basic", Username: "pkgr", PasswordEnv: "INTERNAL_PASSWORD"}},
+				{"CRAN": RepoConfig{RepoSuffix: "suffix"}},
+			},
+		},
+	}
+	var rs rcmd.RSettings
+	rs.PkgEnvVars = make(map[string]map[string]string)
+	rs2 := SetCustomizations(rs, cfg)
+	assert.Equal(t, []string{"PRIVATE_TOKEN", "INTERNAL_PASSWORD"}, rs2.CensoredEnvVars)
+}
+
 func TestSetCfgCustomizations(t *testing.T) {
 	tests := []struct {
 		pkg string
@@ -932,7 +959,7 @@ func TestNewConfigSimple(t *testing.T) {
 	assert.Contains(t, cfg.Packages, "pillar")
 	assert.Equal(t, cfg.Library, "test-library", cfg.Library)
 	assert.Equal(t, 1, cfg.Version)
-	assert.Equal(t, "", cfg.Cache)
+	assert.Equal(t, "", cfg.Cache.Dir)
 	assert.Empty(t, cfg.Tarballs)
 	assert.Equal(t, "R", filepath.Base(cfg.RPath)) // Just make sure the path ends in R executable. May not work on Windows.
 	assert.Equal(t, LogConfig{}, cfg.Logging)
@@ -964,7 +991,7 @@ func TestNewConfigNonDefaults(t *testing.T) {
 	assert.True(t, strings.Contains(cfg.Library, "renv/")) // Should be set because of Lockfile setting.
 
 	assert.Equal(t, 1, cfg.Version)
-	assert.Equal(t, "./localcache", cfg.Cache)
+	assert.Equal(t, "./localcache", cfg.Cache.Dir)
 	assert.True(t, strings.Contains(cfg.Tarballs[0], "folder/tarball.tar.gz")) // Should be set somewhere in the homedir.
 	// assert.Equal(t, "../R", cfg.RPath) // Disabling this to make the test easier.
 	assert.Equal(t, LogConfig{
@@ -1055,3 +1082,41 @@ func getIntegrationTestFolder(t *testing.T, folder string) string {
 	sa := strings.SplitAfter(filename, "/pkgr/")
 	return filepath.Join(filepath.Dir(sa[0]), "integration_tests", folder)
 }
+
+func TestParseCacheConfig(t *testing.T) {
+	tests := map[string]struct {
+		in       interface{}
+		expected CacheConfig
+	}{
+		"unset":     {nil, CacheConfig{}},
+		"directory": {"~/pkgcache", CacheConfig{Dir: "~/pkgcache"}},
+		"settings":  {map[string]interface{}{"dir": "~/pkgcache", "maxsize": "20G"}, CacheConfig{Dir: "~/pkgcache", MaxSize: "20G"}},
+		"max size":  {map[string]interface{}{"MaxSize": 1024}, CacheConfig{MaxSize: "1024"}},
+	}
+	for name, tt := range tests {
+		actual, err := parseCacheConfig(tt.in)
+		assert.NoError(t, err, name)
+		assert.Equal(t, tt.expected, actual, name)
+	}
+	for name, in := range map[string]interface{}{
+		"bad size":        map[string]interface{}{"maxsize": "twenty"},
+		"unknown setting": map[string]interface{}{"size": "20G"},
+		"list":            []interface{}{"~/pkgcache"},
+	} {
+		_, err := parseCacheConfig(in)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCacheConfigYAML(t *testing.T) {
+	for _, in := range []string{"Cache: ~/pkgcache\n", "Cache:\n  Dir: ~/pkgcache\n  MaxSize: 20G\n"} {
+		var cfg PkgrConfig
+		assert.NoError(t, yaml.Unmarshal([]byte(in), &cfg))
+		assert.Equal(t, "~/pkgcache", cfg.Cache.Dir)
+		out, err := yaml.Marshal(struct {
+			Cache CacheConfig `yaml:"Cache"`
+		}{cfg.Cache})
+		assert.NoError(t, err)
+		assert.Equal(t, in, string(out))
+	}
+}
@@ -0,0 +1,66 @@
+package configlib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+)
+
+// PinSource is noted as the origin of version constraints set in the config file
+const PinSource = "pkgr.yml"
+
+// pinnedPackageRegex matches a package name optionally followed by a version constraint
+// in the same form R uses for dependencies, eg dplyr, dplyr (== 1.0.7) or ggplot2 (>= 3.3)
+var pinnedPackageRegex = regexp.MustCompile(`^[[:alnum:].]+\s*(\(\s*(==|>=|<=|>|<)\s*\d+([.-]\d+)*\s*\))?$`)
+
+// ParsePackagePin parses a package entry that may contain a version constraint
+func ParsePackagePin(p string) (desc.Dep, error) {
+	p = strings.TrimSpace(p)
+	if !pinnedPackageRegex.MatchString(p) {
+		return desc.Dep{}, fmt.Errorf("invalid package specification: '%s', expected <name> or <name> (<constraint> <version>), eg dplyr (== 1.0.7)", p)
+	}
+	return desc.ParseDep(p), nil
+}
+
+// parseVersionCustomization parses the Version customization of a package,
+// a bare version is treated as an exact pin, eg 1.0.7 is the same as == 1.0.7
+func parseVersionCustomization(pkg string, v string) (desc.Dep, error) {
+	v = strings.TrimSpace(v)
+	if !strings.ContainsAny(v, "<>=") {
+		v = "== " + v
+	}
+	return ParsePackagePin(fmt.Sprintf("%s (%s)", pkg, v))
+}
+
+// splitPackagePins separates any version constraints from the package names,
+// returning the bare package names along with all constraints set inline
+// or via a Version customization
+func splitPackagePins(pkgs []string, c Customizations) ([]string, []desc.Dep, error) {
+	var names []string
+	var pins []desc.Dep
+	for _, p := range pkgs {
+		dep, err := ParsePackagePin(p)
+		if err != nil {
+			return pkgs, pins, err
+		}
+		names = append(names, dep.Name)
+		if dep.Constraint != desc.None {
+			pins = append(pins, dep)
+		}
+	}
+	for _, pkgCustomizations := range c.Packages {
+		for pkg, v := range pkgCustomizations {
+			if v.Version == "" {
+				continue
+			}
+			dep, err := parseVersionCustomization(pkg, v.Version)
+			if err != nil {
+				return pkgs, pins, err
+			}
+			pins = append(pins, dep)
+		}
+	}
+	return names, pins, nil
+}
@@ -0,0 +1,93 @@
+package configlib
+
+import (
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePackagePin(t *testing.T) {
+	tests := map[string]struct {
+		in       string
+		expected desc.Dep
+		err      bool
+	}{
+		"bare package": {
+			in:       "dplyr",
+			expected: desc.Dep{Name: "dplyr"},
+		},
+		"exact pin": {
+			in:       "dplyr (== 1.0.7)",
+			expected: desc.ParseDep("dplyr (== 1.0.7)"),
+		},
+		"minimum version without spaces": {
+			in:       "ggplot2(>=3.3)",
+			expected: desc.ParseDep("ggplot2 (>= 3.3)"),
+		},
+		"package name with dot": {
+			in:       "data.table (< 1.14-2)",
+			expected: desc.ParseDep("data.table (< 1.14-2)"),
+		},
+		"unknown constraint": {
+			in:  "dplyr (~= 1.0.7)",
+			err: true,
+		},
+		"single component version": {
+			in:       "pkg (>= 1)",
+			expected: desc.ParseDep("pkg (>= 1)"),
+		},
+		"version must be numeric": {
+			in:  "dplyr (== 1.x)",
+			err: true,
+		},
+		"missing parens": {
+			in:  "dplyr == 1.0.7",
+			err: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ParsePackagePin(tt.in)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.Name, actual.Name)
+			assert.Equal(t, tt.expected.Constraint, actual.Constraint)
+			assert.Equal(t, 0, desc.CompareVersions(tt.expected.Version, actual.Version))
+		})
+	}
+}
+
+func TestSplitPackagePins(t *testing.T) {
+	c := Customizations{
+		Packages: []map[string]PkgConfig{
+			{"rlang": PkgConfig{Version: "0.4.11"}},
+			{"ggplot2": PkgConfig{Version: ">= 3.3"}},
+			{"shiny": PkgConfig{Suggests: true}},
+		},
+	}
+	names, pins, err := splitPackagePins([]string{"dplyr (== 1.0.7)", "ggplot2", "shiny"}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dplyr", "ggplot2", "shiny"}, names)
+	assert.Equal(t, []string{
+		"dplyr (== 1.0.7)",
+		"rlang (== 0.4.11)",
+		"ggplot2 (>= 3.3)",
+	}, depStrings(pins))
+
+	_, _, err = splitPackagePins([]string{"dplyr"}, Customizations{
+		Packages: []map[string]PkgConfig{{"dplyr": PkgConfig{Version: "latest"}}},
+	})
+	assert.Error(t, err)
+}
+
+func depStrings(deps []desc.Dep) []string {
+	var s []string
+	for _, d := range deps {
+		s = append(s, d.ToString())
+	}
+	return s
+}
@@ -1,11 +1,14 @@
 package configlib
 
+import "github.com/metrumresearchgroup/pkgr/desc"
+
 // PkgConfig provides information about custom settings during package installation
 type PkgConfig struct {
 	Suggests bool              `yaml:"Suggests,omitempty"`
 	Env      map[string]string `yaml:"Env,omitempty"`
 	Repo     string            `yaml:"Repo,omitempty"`
 	Type     string            `yaml:"Type,omitempty"`
+	Version  string            `yaml:"Version,omitempty"`
 }
 
 // PkgSettingsMap ...
@@ -17,6 +20,29 @@ type RepoConfig struct {
 	Type       string `yaml:"Type,omitempty"`
 	RepoType   string `yaml:"RepoType,omitempty"`
 	RepoSuffix string `yaml:"RepoSuffix,omitempty"`
+	// BiocVersion sets the Bioconductor release for RepoType: bioconductor,
+	// defaulting to the most recent release for the R version
+	BiocVersion string `yaml:"BiocVersion,omitempty"`
+	// Snapshot freezes a RepoType: RSPM repo to a snapshot date (YYYY-MM-DD) or id
+	Snapshot string `yaml:"Snapshot,omitempty"`
+	// Mirrors are urls with the same content as the repo, tried in order when it cannot be reached
+	Mirrors []string `yaml:"Mirrors,omitempty"`
+	// Include and Exclude restrict the packages the repo may provide to those matching
+	// any Include pattern and no Exclude pattern, eg metrum* for an internal repo
+	Include []string `yaml:"Include,omitempty"`
+	Exclude []string `yaml:"Exclude,omitempty"`
+	// Auth is one of basic, bearer or netrc. Secrets are read from the
+	// environment variables named by PasswordEnv/TokenEnv, never the config
+	Auth        string `yaml:"Auth,omitempty"`
+	Username    string `yaml:"Username,omitempty"`
+	PasswordEnv string `yaml:"PasswordEnv,omitempty"`
+	TokenEnv    string `yaml:"TokenEnv,omitempty"`
+	Netrc       string `yaml:"Netrc,omitempty"`
+	// CACert is a PEM bundle of additional CAs to trust for the repo, and
+	// ClientCert/ClientKey a PEM certificate and key for mutual TLS
+	CACert     string `yaml:"CACert,omitempty"`
+	ClientCert string `yaml:"ClientCert,omitempty"`
+	ClientKey  string `yaml:"ClientKey,omitempty"`
 }
 
 // LogConfig stores information for logging purposes
@@ -33,6 +59,38 @@ type Customizations struct {
 	Repos    []map[string]RepoConfig `yaml:"Repos,omitempty"`
 }
 
+// CacheConfig provides the package cache settings, given either as the
+// path of the cache directory or with the settings:
+//
+//	Cache:
+//	  Dir: ~/.cache/pkgr
+//	  MaxSize: 20G
+type CacheConfig struct {
+	Dir string `yaml:"Dir,omitempty"`
+	// MaxSize is the size the package cache is reduced to after installing, such as 20G
+	MaxSize string `yaml:"MaxSize,omitempty"`
+}
+
+// UnmarshalYAML reads the cache settings given either as the cache directory or as settings
+func (c *CacheConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var dir string
+	if err := unmarshal(&dir); err == nil {
+		c.Dir = dir
+		return nil
+	}
+	type settings CacheConfig
+	return unmarshal((*settings)(c))
+}
+
+// MarshalYAML writes the cache settings as the cache directory unless there are other settings
+func (c CacheConfig) MarshalYAML() (interface{}, error) {
+	if c.MaxSize == "" {
+		return c.Dir, nil
+	}
+	type settings CacheConfig
+	return settings(c), nil
+}
+
 // Lockfile struct hold values for packrat lockfile support
 type Lockfile struct {
 	Type string `yaml:"Type,omitempty"`
@@ -54,12 +112,22 @@ type PkgrConfig struct {
 	Customizations Customizations      `yaml:"Customizations,omitempty"`
 	Threads        int                 `yaml:"Threads,omitempty"`
 	RPath          string              `yaml:"RPath,omitempty" mapstructure:"rpath,omitempty"`
-	Cache          string              `yaml:"Cache,omitempty"`
+	Cache          CacheConfig         `yaml:"Cache,omitempty" mapstructure:"-"`
 	Logging        LogConfig           `yaml:"Logging,omitempty"`
 	Update         bool                `yaml:"Update,omitempty"`
 	Lockfile       Lockfile            `yaml:"Lockfile,omitempty"`
 	Strict         bool                `yaml:"Strict,omitempty"`
 	NoSecure       bool                `yaml:"NoSecure,omitempty"`
+	SkipVerify     bool                `yaml:"SkipVerify,omitempty"`
+	Offline        bool                `yaml:"Offline,omitempty"`
+	// StrictRepos refuses to install packages available from more than one repo
+	// unless their repo is set with a Repo customization
+	StrictRepos bool `yaml:"StrictRepos,omitempty"`
+	// NewerSource installs packages of Type: both from source when the source version is newer than the binary
+	NewerSource bool `yaml:"NewerSource,omitempty"`
+	// PackagePins are the version constraints parsed from Packages and
+	// Version customizations, and are never read directly from the config
+	PackagePins    []desc.Dep          `yaml:"-" mapstructure:"-"`
 }
 
 /*	viper.SetDefault("debug", false)
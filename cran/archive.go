@@ -0,0 +1,306 @@
+package cran
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dpastoor/goutils"
+	"github.com/metrumresearchgroup/pkgr/desc"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// archivePath provides the Path, relative to src/contrib, that archived
+// versions of a package are stored under in CRAN-like repos
+func archivePath(pkg string) string {
+	return "Archive/" + pkg
+}
+
+func archiveURL(r RepoURL, pkg string) string {
+	return fmt.Sprintf("%s/src/contrib/%s", strings.TrimSuffix(r.URL, "/"), archivePath(pkg))
+}
+
+// GetArchivedVersions lists the versions of a package available in the
+// src/contrib/Archive/<pkg> directory of the repo, newest first, returning
+// ErrNotFound if there are none. The listing is only queried once per package.
+func (repoDb *RepoDb) GetArchivedVersions(pkg string, noSecure bool) ([]string, error) {
+	repoDb.archiveMutex.Lock()
+	defer repoDb.archiveMutex.Unlock()
+	if versions, ok := repoDb.archivedVersions[pkg]; ok {
+		if len(versions) == 0 {
+			return versions, ErrNotFound
+		}
+		return versions, nil
+	}
+	var versions []string
+	files, err := listRepoDir(repoDb.Repo, archiveURL(repoDb.Repo, pkg), noSecure)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return versions, err
+	}
+	prefix := pkg + "_"
+	for _, f := range files {
+		if strings.HasPrefix(f, prefix) && strings.HasSuffix(f, ".tar.gz") {
+			versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(f, prefix), ".tar.gz"))
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return desc.CompareVersionStrings(versions[i], versions[j]) > 0
+	})
+	if repoDb.archivedVersions == nil {
+		repoDb.archivedVersions = make(map[string][]string)
+	}
+	repoDb.archivedVersions[pkg] = versions
+	if len(versions) == 0 {
+		return versions, ErrNotFound
+	}
+	return versions, nil
+}
+
+// GetArchivedPackage provides the description of an archived version of a package
+// by reading the DESCRIPTION file from within the archived tarball. The description is
+// kept, so each version is only read once however many times it is asked for.
+// When cacheDir is set, the tarball is downloaded to the package cache at cacheDir, where
+// it is installed from, and the description carries the MD5sum of the tarball, to be verified
+// against on download. A tarball downloaded is kept by keepArchivedPackage if the version
+// is used, or removed by discardArchivedPackage otherwise.
+func (repoDb *RepoDb) GetArchivedPackage(fs afero.Fs, cacheDir string, pkg string, version string, noSecure bool) (desc.Desc, error) {
+	key := pkg + "_" + version
+	repoDb.archiveMutex.Lock()
+	pkgDesc, ok := repoDb.archivedPackages[key]
+	repoDb.archiveMutex.Unlock()
+	if ok {
+		return pkgDesc, nil
+	}
+	pkgDesc, dest, err := repoDb.readArchivedPackage(fs, cacheDir, pkg, version, noSecure)
+	if err != nil {
+		return pkgDesc, err
+	}
+	repoDb.archiveMutex.Lock()
+	defer repoDb.archiveMutex.Unlock()
+	if repoDb.archivedPackages == nil {
+		repoDb.archivedPackages = make(map[string]desc.Desc)
+		repoDb.archivedDownloads = make(map[string]string)
+	}
+	repoDb.archivedPackages[key] = pkgDesc
+	if dest != "" {
+		repoDb.archivedDownloads[key] = dest
+	}
+	return pkgDesc, nil
+}
+
+// readArchivedPackage reads the description from an archived tarball, providing
+// the path in cacheDir the tarball was downloaded to, if it was not already there
+func (repoDb *RepoDb) readArchivedPackage(fs afero.Fs, cacheDir string, pkg string, version string, noSecure bool) (desc.Desc, string, error) {
+	tarball := fmt.Sprintf("%s/%s_%s.tar.gz", archiveURL(repoDb.Repo, pkg), pkg, version)
+	if cacheDir == "" {
+		body, err := openRepoFile(repoDb.Repo, tarball, noSecure)
+		if err != nil {
+			return desc.Desc{}, "", fmt.Errorf("error fetching %s: %s", tarball, err)
+		}
+		defer body.Close()
+		pkgDesc, err := readTarballDescription(body, pkg)
+		if err != nil {
+			return pkgDesc, "", fmt.Errorf("error reading DESCRIPTION from %s: %s", tarball, err)
+		}
+		pkgDesc.Path = archivePath(pkg)
+		return pkgDesc, "", nil
+	}
+	dest := packageCachePath(PkgDl{
+		Package: desc.Desc{Package: pkg, Version: version},
+		Config:  PkgConfig{Repo: repoDb.Repo, Type: Source},
+	}, cacheDir, RVersion{}, Platform{})
+	downloaded := ""
+	if exists, _ := goutils.Exists(fs, dest); !exists {
+		if err := fs.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+			return desc.Desc{}, "", err
+		}
+		if _, _, err := downloadFromMirrors(fs, repoDb.Repo, tarball, dest, noSecure); err != nil {
+			return desc.Desc{}, "", fmt.Errorf("error fetching %s: %s", tarball, err)
+		}
+		downloaded = dest
+	}
+	f, err := fs.Open(dest)
+	if err != nil {
+		return desc.Desc{}, "", err
+	}
+	pkgDesc, err := readTarballDescription(f, pkg)
+	f.Close()
+	if err != nil {
+		// never leave a bad tarball in the cache
+		fs.Remove(dest)
+		return pkgDesc, "", fmt.Errorf("error reading DESCRIPTION from %s: %s", tarball, err)
+	}
+	pkgDesc.Path = archivePath(pkg)
+	sum, err := FileMD5(fs, dest)
+	if err != nil {
+		return pkgDesc, "", err
+	}
+	pkgDesc.MD5sum = sum
+	return pkgDesc, downloaded, nil
+}
+
+// keepArchivedPackage adds the tarball of an archived package used by the plan,
+// if it was downloaded to the package cache at cacheDir, to the package store
+func (repoDb *RepoDb) keepArchivedPackage(fs afero.Fs, cacheDir string, d desc.Desc) {
+	repoDb.archiveMutex.Lock()
+	key := d.Package + "_" + d.Version
+	dest, ok := repoDb.archivedDownloads[key]
+	delete(repoDb.archivedDownloads, key)
+	repoDb.archiveMutex.Unlock()
+	if !ok {
+		return
+	}
+	if err := NewPackageStore(fs, cacheDir).Put(dest, d.MD5sum); err != nil {
+		log.WithFields(log.Fields{
+			"package": d.Package,
+			"error":   err,
+		}).Warn("could not add package to the package store")
+	}
+}
+
+// discardArchivedPackage removes the tarball of an archived package not used by the
+// plan, if it was downloaded to the package cache, so only the tarballs used are kept.
+// Its description is still kept, so it is not downloaded again.
+func (repoDb *RepoDb) discardArchivedPackage(fs afero.Fs, pkg string, version string) {
+	repoDb.archiveMutex.Lock()
+	key := pkg + "_" + version
+	dest, ok := repoDb.archivedDownloads[key]
+	delete(repoDb.archivedDownloads, key)
+	repoDb.archiveMutex.Unlock()
+	if ok {
+		fs.Remove(dest)
+	}
+}
+
+// readTarballDescription parses the <pkg>/DESCRIPTION file from a package source tarball
+func readTarballDescription(r io.Reader, pkg string) (desc.Desc, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return desc.Desc{}, err
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return desc.Desc{}, fmt.Errorf("no DESCRIPTION file found for %s", pkg)
+		}
+		if err != nil {
+			return desc.Desc{}, err
+		}
+		if strings.TrimPrefix(hdr.Name, "./") == pkg+"/DESCRIPTION" {
+			return desc.ParseDesc(tr)
+		}
+	}
+}
+
+// ResolveArchivedPackage searches the archive of each repo for the newest version of a package
+// that satisfies its version constraints and the R version. A version found is made available
+// from the package database as a source package and is only used if no current version of
+// the package satisfies the constraints. Returns whether a version was found.
+// Each archived version is read once per plan, and only the tarball of the version
+// used is kept in the PackageCache, if set, to be installed from.
+// Only packages with version constraints, or in the index of a repo, are searched for,
+// so misspelled package names do not query the archive of every repo.
+func (pkgNexus *PkgNexus) ResolveArchivedPackage(pkg string) bool {
+	if pkgNexus.Config.Offline {
+		log.WithField("pkg", pkg).Debug("offline, not searching repo archives")
+		return false
+	}
+	if _, constrained := pkgNexus.Constraints[pkg]; !constrained && len(pkgNexus.GetAvailableVersions(pkg)) == 0 {
+		log.WithField("pkg", pkg).Debug("package has no version constraints and is in no repo index, not searching repo archives")
+		return false
+	}
+	for _, db := range pkgNexus.Db {
+		if !isCorrectRepo(pkg, db.Repo, pkgNexus.Config.Packages) || !pkgNexus.repoAllows(db.Repo, pkg) {
+			continue
+		}
+		versions, err := db.GetArchivedVersions(pkg, pkgNexus.NoSecure)
+		if errors.Is(err, ErrNotFound) {
+			log.WithFields(log.Fields{
+				"pkg":  pkg,
+				"repo": db.Repo.Name,
+			}).Debug("no archived versions")
+			continue
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"pkg":   pkg,
+				"repo":  db.Repo.Name,
+				"error": err,
+			}).Warn("could not list archived versions")
+			continue
+		}
+		for _, v := range versions {
+			if !pkgNexus.Constraints.IsSatisfiedBy(desc.Desc{Package: pkg, Version: v}) || db.hasArchivedPackage(pkg, v) {
+				continue
+			}
+			pkgDesc, err := db.GetArchivedPackage(pkgNexus.fs(), pkgNexus.PackageCache, pkg, v, pkgNexus.NoSecure)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"pkg":     pkg,
+					"version": v,
+					"repo":    db.Repo.Name,
+					"error":   err,
+				}).Warn("could not read archived package")
+				continue
+			}
+			if _, ok := isRVersionCompatible(pkgDesc, pkgNexus.RVersion); !ok {
+				log.WithFields(log.Fields{
+					"pkg":     pkg,
+					"version": v,
+					"repo":    db.Repo.Name,
+				}).Debug("archived version incompatible with R version")
+				db.discardArchivedPackage(pkgNexus.fs(), pkg, v)
+				continue
+			}
+			db.addArchivedPackage(pkgDesc)
+			db.keepArchivedPackage(pkgNexus.fs(), pkgNexus.PackageCache, pkgDesc)
+			fields := log.Fields{
+				"pkg":     pkg,
+				"version": v,
+				"repo":    db.Repo.Name,
+			}
+			if newer, ok := pkgNexus.RVersionDowngrade(pkg, pkgDesc); ok {
+				fields["newer"] = newer
+				log.WithFields(fields).Info("using archived version as newer versions require a newer R version")
+				return true
+			}
+			log.WithFields(fields).Info("using archived version to satisfy version constraints")
+			return true
+		}
+	}
+	return false
+}
+
+// fs provides the file system the package cache is on
+func (pkgNexus *PkgNexus) fs() afero.Fs {
+	if pkgNexus.Fs == nil {
+		return afero.NewOsFs()
+	}
+	return pkgNexus.Fs
+}
+
+func (repoDb *RepoDb) hasArchivedPackage(pkg string, version string) bool {
+	for _, d := range repoDb.ArchivedDescriptions[pkg] {
+		if d.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// addArchivedPackage adds the description of an archived package, keeping
+// the archived versions of each package ordered newest first
+func (repoDb *RepoDb) addArchivedPackage(d desc.Desc) {
+	if repoDb.ArchivedDescriptions == nil {
+		repoDb.ArchivedDescriptions = make(map[string][]desc.Desc)
+	}
+	addDescription(repoDb.ArchivedDescriptions, d)
+}
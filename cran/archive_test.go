@@ -0,0 +1,229 @@
+package cran
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestTarball writes a minimal source package tarball into dir
+func writeTestTarball(t *testing.T, dir string, pkg string, version string, depends string) {
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s_%s.tar.gz", pkg, version)))
+	require.NoError(t, err)
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	content := fmt.Sprintf("Package: %s\nVersion: %s\n", pkg, version)
+	if depends != "" {
+		content += fmt.Sprintf("Depends: %s\n", depends)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name: pkg + "/DESCRIPTION",
+		Mode: 0644,
+		Size: int64(len(content)),
+	}))
+	_, err = tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+}
+
+// newTestArchiveRepo creates a repo with pkgA 2.0.0 as the current version
+// and 1.0.0, 1.5.0 (requiring a future R version) and 1.2.0 archived
+func newTestArchiveRepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pkgr-archive")
+	require.NoError(t, err)
+	contrib := filepath.Join(dir, "src", "contrib")
+	writeTestTarball(t, contrib, "pkgA", "2.0.0", "")
+	archive := filepath.Join(contrib, "Archive", "pkgA")
+	writeTestTarball(t, archive, "pkgA", "1.0.0", "")
+	writeTestTarball(t, archive, "pkgA", "1.2.0", "R (>= 3.5.0)")
+	writeTestTarball(t, archive, "pkgA", "1.5.0", "R (>= 99.0.0)")
+	return dir
+}
+
+func newTestArchiveNexus(url string) *PkgNexus {
+	db := &RepoDb{
+		DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{
+			Source: {"pkgA": {{Package: "pkgA", Version: "2.0.0"}}},
+			Binary: {},
+		},
+		Repo: RepoURL{Name: "local", URL: url},
+	}
+	pkgNexus := newTestNexus(db)
+	pkgNexus.RVersion = RVersion{Major: 4, Minor: 1, Patch: 2}
+	return pkgNexus
+}
+
+func TestGetArchivedVersions(t *testing.T) {
+	dir := newTestArchiveRepo(t)
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	for _, url := range []string{dir, "file://" + dir, server.URL} {
+		t.Run(url, func(t *testing.T) {
+			db := &RepoDb{Repo: RepoURL{Name: "local", URL: url}}
+			versions, err := db.GetArchivedVersions("pkgA", false)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"1.5.0", "1.2.0", "1.0.0"}, versions)
+
+			versions, err = db.GetArchivedVersions("notArchived", false)
+			assert.Equal(t, ErrNotFound, err)
+			assert.Empty(t, versions)
+		})
+	}
+}
+
+func TestResolveArchivedPackage(t *testing.T) {
+	dir := newTestArchiveRepo(t)
+	defer os.RemoveAll(dir)
+	pkgNexus := newTestArchiveNexus(dir)
+	pkgNexus.AddConstraint(desc.Dep{Name: "pkgA", Version: desc.ParseVersion("2.0.0"), Constraint: desc.LT}, "test")
+
+	_, _, found := pkgNexus.GetPackage("pkgA")
+	assert.False(t, found)
+
+	// 1.5.0 is skipped as it requires a newer version of R
+	assert.True(t, pkgNexus.ResolveArchivedPackage("pkgA"))
+	pkgDesc, cfg, found := pkgNexus.GetPackage("pkgA")
+	assert.True(t, found)
+	assert.Equal(t, "1.2.0", pkgDesc.Version)
+	assert.Equal(t, "Archive/pkgA", pkgDesc.Path)
+	assert.Equal(t, Source, cfg.Type)
+	assert.Equal(t, "local", cfg.Repo.Name)
+	assert.Equal(t, []string{"2.0.0 (local, source)", "1.2.0 (local, archive)"}, pkgNexus.GetAvailableVersions("pkgA"))
+
+	pkgNexus.AddConstraint(desc.Dep{Name: "pkgA", Version: desc.ParseVersion("3.0.0"), Constraint: desc.GTE}, "test")
+	assert.False(t, pkgNexus.ResolveArchivedPackage("pkgA"))
+}
+
+func TestResolveArchivedPackageKeepsTarball(t *testing.T) {
+	dir := newTestArchiveRepo(t)
+	defer os.RemoveAll(dir)
+	var fetched int32
+	files := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tar.gz") {
+			atomic.AddInt32(&fetched, 1)
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	fs := afero.NewMemMapFs()
+	pkgNexus := newTestArchiveNexus(server.URL)
+	pkgNexus.PackageCache = "/cache"
+	pkgNexus.Fs = fs
+	pkgNexus.AddConstraint(desc.Dep{Name: "pkgA", Version: desc.ParseVersion("2.0.0"), Constraint: desc.LT}, "test")
+
+	require.True(t, pkgNexus.ResolveArchivedPackage("pkgA"))
+	pkgDesc, cfg, found := pkgNexus.GetPackage("pkgA")
+	require.True(t, found)
+	assert.Equal(t, "1.2.0", pkgDesc.Version)
+	assert.NotEmpty(t, pkgDesc.MD5sum)
+	// 1.5.0 is read and rejected for requiring a newer R, then 1.2.0 is read
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+
+	d := PkgDl{Package: pkgDesc, Config: cfg}
+	dest := packageCachePath(d, "/cache", RVersion{}, Platform{})
+	dl, err := DownloadPackage(fs, d, dest, RVersion{}, Platform{}, false, false, false)
+	assert.NoError(t, err)
+	assert.False(t, dl.New, "the tarball read while resolving is installed from")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+	stored, _ := afero.Exists(fs, NewPackageStore(fs, "/cache").ObjectPath(pkgDesc.MD5sum))
+	assert.True(t, stored)
+	rejected, _ := afero.Exists(fs, packageCachePath(PkgDl{
+		Package: desc.Desc{Package: "pkgA", Version: "1.5.0"},
+		Config:  cfg,
+	}, "/cache", RVersion{}, Platform{}))
+	assert.False(t, rejected, "only the tarball of the version used is kept")
+
+	// later constraint passes reuse the descriptions already read
+	pkgNexus.Db[0].ArchivedDescriptions = nil
+	require.True(t, pkgNexus.ResolveArchivedPackage("pkgA"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+}
+
+func TestResolveArchivedPackageReadsOnce(t *testing.T) {
+	dir := newTestArchiveRepo(t)
+	defer os.RemoveAll(dir)
+	var fetched int32
+	files := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tar.gz") {
+			atomic.AddInt32(&fetched, 1)
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	pkgNexus := newTestArchiveNexus(server.URL)
+	pkgNexus.AddConstraint(desc.Dep{Name: "pkgA", Version: desc.ParseVersion("2.0.0"), Constraint: desc.LT}, "test")
+
+	// without a package cache the tarballs are streamed, but still only read once
+	for i := 0; i < 3; i++ {
+		pkgNexus.Db[0].ArchivedDescriptions = nil
+		require.True(t, pkgNexus.ResolveArchivedPackage("pkgA"))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetched))
+}
+
+func TestResolveArchivedPackageSkipsUnknownPackages(t *testing.T) {
+	pkgNexus := newTestArchiveNexus("https://repo.invalid")
+	// neither constrained nor in the index, such as a misspelled package name
+	assert.False(t, pkgNexus.ResolveArchivedPackage("pkgAA"))
+	assert.Empty(t, pkgNexus.Db[0].archivedVersions)
+}
+
+func TestDownloadArchivedPackage(t *testing.T) {
+	dir := newTestArchiveRepo(t)
+	defer os.RemoveAll(dir)
+	dest, err := ioutil.TempDir("", "pkgr-archive-dl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dest)
+	fs := afero.NewOsFs()
+	repo := RepoURL{Name: "local", URL: dir}
+
+	tests := []struct {
+		name string
+		pkg  desc.Desc
+	}{
+		{"archived version", desc.Desc{Package: "pkgA", Version: "1.0.0", Path: "Archive/pkgA"}},
+		{"superseded version missing from index", desc.Desc{Package: "pkgA", Version: "1.2.0"}},
+		{"current version", desc.Desc{Package: "pkgA", Version: "2.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgFile := filepath.Join(dest, fmt.Sprintf("%s_%s.tar.gz", tt.pkg.Package, tt.pkg.Version))
+			dl, err := DownloadPackage(fs, PkgDl{Package: tt.pkg, Config: PkgConfig{Repo: repo, Type: Source}}, pkgFile, RVersion{}, Platform{}, false, false, false)
+			assert.NoError(t, err)
+			assert.True(t, dl.New)
+			f, err := os.Open(pkgFile)
+			require.NoError(t, err)
+			defer f.Close()
+			pkgDesc, err := readTarballDescription(f, tt.pkg.Package)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.pkg.Version, pkgDesc.Version)
+		})
+	}
+
+	_, err = DownloadPackage(fs, PkgDl{
+		Package: desc.Desc{Package: "pkgA", Version: "0.1.0"},
+		Config:  PkgConfig{Repo: repo, Type: Source},
+	}, filepath.Join(dest, "pkgA_0.1.0.tar.gz"), RVersion{}, Platform{}, false, false, false)
+	assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound, got %v", err)
+}
@@ -0,0 +1,202 @@
+package cran
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+)
+
+// Auth types supported for repos
+const (
+	BasicAuth  = "basic"
+	BearerAuth = "bearer"
+	NetrcAuth  = "netrc"
+)
+
+// EnvVars provides the names of the environment variables holding secrets for the repo,
+// which should be censored anywhere environment variables are logged
+func (a RepoAuth) EnvVars() []string {
+	var envs []string
+	if a.PasswordEnv != "" {
+		envs = append(envs, a.PasswordEnv)
+	}
+	if a.TokenEnv != "" {
+		envs = append(envs, a.TokenEnv)
+	}
+	return envs
+}
+
+// Validate checks the auth settings are complete, without reading any secrets
+func (a RepoAuth) Validate() error {
+	switch strings.ToLower(a.Type) {
+	case "":
+		return nil
+	case BasicAuth:
+		if a.Username == "" || a.PasswordEnv == "" {
+			return fmt.Errorf("basic auth requires both Username and PasswordEnv")
+		}
+	case BearerAuth:
+		if a.TokenEnv == "" {
+			return fmt.Errorf("bearer auth requires TokenEnv")
+		}
+	case NetrcAuth:
+	default:
+		return fmt.Errorf("invalid auth type: %s, must be one of %s, %s or %s", a.Type, BasicAuth, BearerAuth, NetrcAuth)
+	}
+	return nil
+}
+
+// apply adds the credentials for the repo to a request. Errors never include the secret values.
+func (a RepoAuth) apply(req *http.Request) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	switch strings.ToLower(a.Type) {
+	case BasicAuth:
+		password, err := getSecretEnv(a.PasswordEnv)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(a.Username, password)
+	case BearerAuth:
+		token, err := getSecretEnv(a.TokenEnv)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case NetrcAuth:
+		login, password, found, err := lookupNetrc(a.netrcPath(), req.URL.Hostname())
+		if err != nil {
+			return err
+		}
+		if !found {
+			log.WithField("host", req.URL.Hostname()).Debug("no netrc entry found for host")
+			return nil
+		}
+		req.SetBasicAuth(login, password)
+	}
+	return nil
+}
+
+func getSecretEnv(env string) (string, error) {
+	val, ok := os.LookupEnv(env)
+	if !ok || val == "" {
+		return "", fmt.Errorf("environment variable %s for repo auth is not set", env)
+	}
+	return val, nil
+}
+
+// netrcPath provides the netrc file to use, following the same
+// precedence as curl: the configured file, then NETRC, then the home directory
+func (a RepoAuth) netrcPath() string {
+	if a.NetrcFile != "" {
+		p, _ := homedir.Expand(a.NetrcFile)
+		return p
+	}
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, _ := homedir.Dir()
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// lookupNetrc finds the login and password for a host in a netrc file,
+// falling back to the default entry if one is present
+func lookupNetrc(path string, host string) (string, string, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	defer f.Close()
+	type entry struct {
+		login    string
+		password string
+	}
+	var current, match, def *entry
+	inMacro := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// macro definitions run until an empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			if strings.HasPrefix(fields[i], "#") {
+				break
+			}
+			next := ""
+			if i+1 < len(fields) {
+				next = fields[i+1]
+			}
+			switch fields[i] {
+			case "machine":
+				current = &entry{}
+				if next == host && match == nil {
+					match = current
+				}
+				i++
+			case "default":
+				current = &entry{}
+				if def == nil {
+					def = current
+				}
+			case "login":
+				if current != nil {
+					current.login = next
+				}
+				i++
+			case "password":
+				if current != nil {
+					current.password = next
+				}
+				i++
+			case "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", false, err
+	}
+	if match == nil {
+		match = def
+	}
+	if match == nil {
+		return "", "", false, nil
+	}
+	return match.login, match.password, true, nil
+}
+
+// newRepoRequest creates a GET request to a url of the repo, with the credentials for the repo applied
+func newRepoRequest(r RepoURL, url string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+	if err := r.Auth.apply(req); err != nil {
+		return nil, fmt.Errorf("repo %s: %s", r.Name, err)
+	}
+	return req, nil
+}
@@ -0,0 +1,89 @@
+package cran
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoAuthApply(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	require.NoError(t, ioutil.WriteFile(netrc, []byte(`# private repos
+machine other.example.com login other password wrong
+machine repo.example.com
+  login netrcuser
+  password netrcpass
+macdef init
+  machine repo.example.com login macro password macro
+
+default login anon password anonpass
+`), 0600))
+	os.Setenv("PKGR_TEST_TOKEN", "s3cret")
+	os.Setenv("PKGR_TEST_PASSWORD", "pa55")
+	defer os.Unsetenv("PKGR_TEST_TOKEN")
+	defer os.Unsetenv("PKGR_TEST_PASSWORD")
+
+	tests := []struct {
+		name   string
+		auth   RepoAuth
+		url    string
+		header string
+		err    string
+	}{
+		{"no auth", RepoAuth{}, "https://repo.example.com", "", ""},
+		{"bearer", RepoAuth{Type: "bearer", TokenEnv: "PKGR_TEST_TOKEN"}, "https://repo.example.com", "Bearer s3cret", ""},
+		{"basic", RepoAuth{Type: "Basic", Username: "user", PasswordEnv: "PKGR_TEST_PASSWORD"}, "https://repo.example.com", "Basic dXNlcjpwYTU1", ""},
+		{"netrc machine", RepoAuth{Type: "netrc", NetrcFile: netrc}, "https://repo.example.com/src/contrib", "Basic bmV0cmN1c2VyOm5ldHJjcGFzcw==", ""},
+		{"netrc default", RepoAuth{Type: "netrc", NetrcFile: netrc}, "https://cran.example.com", "Basic YW5vbjphbm9ucGFzcw==", ""},
+		{"missing netrc", RepoAuth{Type: "netrc", NetrcFile: filepath.Join(t.TempDir(), "missing")}, "https://repo.example.com", "", ""},
+		{"unset token", RepoAuth{Type: "bearer", TokenEnv: "PKGR_TEST_UNSET"}, "https://repo.example.com", "", "repo private: environment variable PKGR_TEST_UNSET for repo auth is not set"},
+		{"incomplete basic", RepoAuth{Type: "basic", Username: "user"}, "https://repo.example.com", "", "repo private: basic auth requires both Username and PasswordEnv"},
+		{"invalid type", RepoAuth{Type: "digest"}, "https://repo.example.com", "", "repo private: invalid auth type: digest, must be one of basic, bearer or netrc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := newRepoRequest(RepoURL{Name: "private", URL: tt.url, Auth: tt.auth}, tt.url)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.header, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestAuthenticatedDownload(t *testing.T) {
+	os.Setenv("PKGR_TEST_TOKEN", "s3cret")
+	defer os.Unsetenv("PKGR_TEST_TOKEN")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("Package: pkgA\nVersion: 1.0.0\n"))
+	}))
+	defer server.Close()
+	dest := filepath.Join(t.TempDir(), "PACKAGES")
+	fs := afero.NewOsFs()
+
+	_, err := downloadFile(fs, RepoURL{Name: "private", URL: server.URL}, server.URL+"/src/contrib/PACKAGES", dest, false)
+	if assert.IsType(t, &HTTPStatusError{}, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.(*HTTPStatusError).StatusCode)
+	}
+
+	repo := RepoURL{Name: "private", URL: server.URL, Auth: RepoAuth{Type: BearerAuth, TokenEnv: "PKGR_TEST_TOKEN"}}
+	_, err = downloadFile(fs, repo, server.URL+"/src/contrib/PACKAGES", dest, false)
+	assert.NoError(t, err)
+	f, err := openRepoFile(repo, server.URL+"/src/contrib/PACKAGES", false)
+	if assert.NoError(t, err) {
+		f.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package cran
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBioconductorURL is used for Bioconductor repos given without a url
+const DefaultBioconductorURL = "https://bioconductor.org"
+
+// biocVersions maps each R version (major.minor) to the Bioconductor
+// releases built for it, oldest first
+var biocVersions = map[string][]string{
+	"3.4": {"3.5", "3.6"},
+	"3.5": {"3.7", "3.8"},
+	"3.6": {"3.9", "3.10"},
+	"4.0": {"3.11", "3.12"},
+	"4.1": {"3.13", "3.14"},
+	"4.2": {"3.15", "3.16"},
+	"4.3": {"3.17", "3.18"},
+	"4.4": {"3.19", "3.20"},
+	"4.5": {"3.21", "3.22"},
+}
+
+// biocSubRepos are the repositories each Bioconductor release is made up of,
+// by the suffix added to the repo name and the path within the release
+var biocSubRepos = []struct {
+	Suffix string
+	Path   string
+}{
+	{"software", "bioc"},
+	{"annotation", "data/annotation"},
+	{"experiment", "data/experiment"},
+	{"workflows", "workflows"},
+}
+
+// BiocVersionForR provides the most recent Bioconductor release for a version of R
+func BiocVersionForR(rv RVersion) (string, bool) {
+	versions, ok := biocVersions[rv.ToString()]
+	if !ok {
+		return "", false
+	}
+	return versions[len(versions)-1], true
+}
+
+// ExpandBioconductorRepo expands a Bioconductor repo into the repos for the software, annotation,
+// experiment and workflow packages of a release. The release used is biocVersion if set, otherwise
+// the most recent release for the R version, and is returned along with the repos.
+func ExpandBioconductorRepo(r RepoURL, biocVersion string, rv RVersion) ([]RepoURL, string, error) {
+	if biocVersion == "" {
+		v, ok := BiocVersionForR(rv)
+		if !ok {
+			return nil, "", fmt.Errorf("no known Bioconductor release for R %s, set BiocVersion for repo %s", rv.ToString(), r.Name)
+		}
+		biocVersion = v
+	} else if intended, ok := biocVersions[rv.ToString()]; !ok || !stringInSlice(biocVersion, intended) {
+		log.WithFields(log.Fields{
+			"repo":         r.Name,
+			"bioc_version": biocVersion,
+			"r_version":    rv.ToString(),
+			"intended":     strings.Join(intended, ", "),
+		}).Warn("Bioconductor release does not match the R version")
+	}
+	base := strings.TrimSuffix(r.URL, "/")
+	if base == "" {
+		base = DefaultBioconductorURL
+	}
+	var repos []RepoURL
+	for _, sr := range biocSubRepos {
+		sub := r
+		sub.Name = fmt.Sprintf("%s-%s", r.Name, sr.Suffix)
+		sub.URL = fmt.Sprintf("%s/packages/%s/%s", base, biocVersion, sr.Path)
+		sub.Group = r.Name
+		sub.Mirrors = nil
+		for _, m := range r.Mirrors {
+			sub.Mirrors = append(sub.Mirrors, fmt.Sprintf("%s/packages/%s/%s", strings.TrimSuffix(m, "/"), biocVersion, sr.Path))
+		}
+		repos = append(repos, sub)
+	}
+	return repos, biocVersion, nil
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
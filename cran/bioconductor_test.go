@@ -0,0 +1,80 @@
+package cran
+
+import (
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandBioconductorRepo(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		biocVersion string
+		rv          RVersion
+		expected    string
+		err         string
+	}{
+		{"default release for R", "https://bioconductor.org", "", RVersion{Major: 4, Minor: 1, Patch: 2}, "3.14", ""},
+		{"explicit release", "https://bioconductor.org/", "3.13", RVersion{Major: 4, Minor: 1, Patch: 2}, "3.13", ""},
+		{"mismatched release is still used", "https://bioconductor.org", "3.10", RVersion{Major: 4, Minor: 1, Patch: 2}, "3.10", ""},
+		{"default url", "", "", RVersion{Major: 4, Minor: 2, Patch: 0}, "3.16", ""},
+		{"unknown R version", "https://bioconductor.org", "", RVersion{Major: 9, Minor: 0, Patch: 0}, "", "no known Bioconductor release for R 9.0, set BiocVersion for repo BioC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos, biocVersion, err := ExpandBioconductorRepo(RepoURL{Name: "BioC", URL: tt.url}, tt.biocVersion, tt.rv)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, biocVersion)
+			base := "https://bioconductor.org/packages/" + tt.expected
+			assert.Equal(t, []RepoURL{
+				{Name: "BioC-software", URL: base + "/bioc", Group: "BioC"},
+				{Name: "BioC-annotation", URL: base + "/data/annotation", Group: "BioC"},
+				{Name: "BioC-experiment", URL: base + "/data/experiment", Group: "BioC"},
+				{Name: "BioC-workflows", URL: base + "/workflows", Group: "BioC"},
+			}, repos)
+		})
+	}
+}
+
+func TestSetPackageRepoGroup(t *testing.T) {
+	software := newTestRepoDb(RepoURL{Name: "BioC-software", Group: "BioC"}, desc.Desc{Package: "limma", Version: "3.50.0"})
+	annotation := newTestRepoDb(RepoURL{Name: "BioC-annotation", Group: "BioC"}, desc.Desc{Package: "org.Hs.eg.db", Version: "3.14.0"})
+	cran := newTestRepoDb(RepoURL{Name: "CRAN"}, desc.Desc{Package: "org.Hs.eg.db", Version: "1.0.0"})
+	pkgNexus := newTestNexus(cran, software, annotation)
+
+	assert.NoError(t, pkgNexus.SetPackageRepo("org.Hs.eg.db", "BioC"))
+	d, cfg, ok := pkgNexus.GetPackage("org.Hs.eg.db")
+	assert.True(t, ok)
+	assert.Equal(t, "3.14.0", d.Version)
+	assert.Equal(t, "BioC-annotation", cfg.Repo.Name)
+
+	assert.Error(t, pkgNexus.SetPackageRepo("limma", "Bioc2"))
+}
+
+func newTestRepoDb(r RepoURL, descs ...desc.Desc) *RepoDb {
+	db := &RepoDb{
+		DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+		Repo:                     r,
+		DefaultSourceType:        Source,
+	}
+	for _, d := range descs {
+		addDescription(db.DescriptionsBySourceType[Source], d)
+	}
+	return db
+}
+
+// newTestNexus provides a PkgNexus for the source packages of the repo databases, in order
+func newTestNexus(dbs ...*RepoDb) *PkgNexus {
+	return &PkgNexus{
+		Db:                dbs,
+		Config:            &InstallConfig{Packages: map[string]PkgConfig{}, Repos: map[string]RepoConfig{}},
+		DefaultSourceType: Source,
+		Constraints:       make(PkgConstraints),
+	}
+}
@@ -0,0 +1,27 @@
+package cran
+
+import (
+	"fmt"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+)
+
+// selectBothVersion picks a version of a package from a repo for packages of type Both.
+// The binary is preferred, with source used when no suitable binary is available, or
+// when the source version is newer and NewerSource is set. Returns the type chosen
+// and the reason for it
+func (pkgNexus *PkgNexus) selectBothVersion(db *RepoDb, pkg string) (desc.Desc, SourceType, string, bool) {
+	bin, binOk := pkgNexus.selectVersion(db.DescriptionsBySourceType[Binary][pkg])
+	src, srcOk := pkgNexus.selectVersion(db.DescriptionsBySourceType[Source][pkg])
+	switch {
+	case binOk && srcOk && pkgNexus.Config.NewerSource && desc.CompareVersionStrings(src.Version, bin.Version) > 0:
+		return src, Source, fmt.Sprintf("source newer than binary %s", bin.Version), true
+	case binOk:
+		return bin, Binary, "binary preferred", true
+	case srcOk && len(db.DescriptionsBySourceType[Binary][pkg]) > 0:
+		return src, Source, "no suitable binary version", true
+	case srcOk:
+		return src, Source, "no binary available", true
+	}
+	return desc.Desc{}, Default, "", false
+}
@@ -0,0 +1,71 @@
+package cran
+
+import (
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPackageBoth(t *testing.T) {
+	db := newTestRepoDb(RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"},
+		desc.Desc{Package: "current", Version: "1.0.0"},
+		desc.Desc{Package: "lagging", Version: "2.1.0"},
+		desc.Desc{Package: "sourceOnly", Version: "1.0.0"},
+		desc.Desc{Package: "oldR", Version: "1.0.0"},
+	)
+	db.DefaultSourceType = Both
+	db.DescriptionsBySourceType[Binary] = map[string][]desc.Desc{}
+	for _, d := range []desc.Desc{
+		{Package: "current", Version: "1.0.0"},
+		{Package: "lagging", Version: "2.0.0"},
+		{Package: "oldR", Version: "1.0.0", Depends: map[string]desc.Dep{"R": {Name: "R", Version: desc.ParseVersion("99.0.0"), Constraint: desc.GTE}}},
+	} {
+		addDescription(db.DescriptionsBySourceType[Binary], d)
+	}
+
+	tests := []struct {
+		name        string
+		newerSource bool
+		pkg         string
+		version     string
+		st          SourceType
+		reason      string
+	}{
+		{"binary preferred", false, "current", "1.0.0", Binary, "binary preferred"},
+		{"lagging binary preferred", false, "lagging", "2.0.0", Binary, "binary preferred"},
+		{"newer source", true, "lagging", "2.1.0", Source, "source newer than binary 2.0.0"},
+		{"same version binary with newer source", true, "current", "1.0.0", Binary, "binary preferred"},
+		{"no binary", false, "sourceOnly", "1.0.0", Source, "no binary available"},
+		{"binary requires newer R", false, "oldR", "1.0.0", Source, "no suitable binary version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgNexus := newTestNexus(db)
+			pkgNexus.Config.NewerSource = tt.newerSource
+			pkgNexus.RVersion = RVersion{Major: 4, Minor: 1, Patch: 2}
+			d, cfg, ok := pkgNexus.GetPackage(tt.pkg)
+			assert.True(t, ok)
+			assert.Equal(t, tt.version, d.Version)
+			assert.Equal(t, tt.st, cfg.Type)
+			assert.Equal(t, tt.reason, cfg.Reason)
+		})
+	}
+}
+
+func TestSetPackageTypeBoth(t *testing.T) {
+	db := newTestRepoDb(RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"}, desc.Desc{Package: "pkgA", Version: "1.0.0"})
+	db.DefaultSourceType = Binary
+	pkgNexus := newTestNexus(db)
+	pkgNexus.DefaultSourceType = Binary
+	// a binary is expected by default, so the package is not found
+	_, _, ok := pkgNexus.GetPackage("pkgA")
+	assert.False(t, ok)
+
+	assert.NoError(t, pkgNexus.SetPackageType("pkgA", "both"))
+	d, cfg, ok := pkgNexus.GetPackage("pkgA")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", d.Version)
+	assert.Equal(t, Source, cfg.Type)
+	assert.Equal(t, "no binary available", cfg.Reason)
+}
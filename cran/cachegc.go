@@ -0,0 +1,198 @@
+package cran
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// TouchCached records that a file of the package cache has just been used, as the
+// modification time of the file, since access times are not kept by many file systems.
+// Files linked from the package store share the time, being the same file.
+func TouchCached(fs afero.Fs, path string) {
+	now := time.Now()
+	if err := fs.Chtimes(path, now, now); err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Trace("could not record use of cached file")
+	}
+}
+
+// CacheGCOptions controls which packages are removed from the package cache by CollectCacheGarbage
+type CacheGCOptions struct {
+	// MaxSize is the size in bytes the cached packages are reduced to,
+	// removing the least recently used first. Unlimited when 0.
+	MaxSize int64
+	// OlderThan removes the packages not used within the duration. Disabled when 0.
+	OlderThan time.Duration
+	// Protected are the packages never removed, such as those of the current plan,
+	// by <package>_<version>
+	Protected map[string]bool
+}
+
+// CacheGCResult describes the packages removed from the package cache
+type CacheGCResult struct {
+	Removed int
+	Freed   int64
+	// Size is the size of the cached packages remaining
+	Size int64
+}
+
+// cacheEntry is a file of the package cache, along with every link to it
+type cacheEntry struct {
+	paths     []string
+	info      os.FileInfo
+	protected bool
+}
+
+// CollectCacheGarbage removes the least recently used packages from the package cache at
+// cacheDir, being the source and binary files of each repo and the package store.
+// Files linked together are counted and removed as one.
+func CollectCacheGarbage(cacheDir string, opts CacheGCOptions, now time.Time) (CacheGCResult, error) {
+	var result CacheGCResult
+	entries, err := cacheEntries(cacheDir)
+	if err != nil {
+		return result, err
+	}
+	for _, e := range entries {
+		for _, p := range e.paths {
+			if opts.Protected[CachedPackageName(filepath.Base(p))] {
+				e.protected = true
+			}
+		}
+		result.Size += e.info.Size()
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].info.ModTime().Before(entries[j].info.ModTime())
+	})
+	for _, e := range entries {
+		if e.protected {
+			continue
+		}
+		expired := opts.OlderThan > 0 && now.Sub(e.info.ModTime()) > opts.OlderThan
+		oversize := opts.MaxSize > 0 && result.Size > opts.MaxSize
+		if !expired && !oversize {
+			continue
+		}
+		for _, p := range e.paths {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return result, err
+			}
+		}
+		log.WithFields(log.Fields{
+			"paths":     e.paths,
+			"last used": e.info.ModTime().Format(time.RFC3339),
+		}).Debug("removed cached package")
+		result.Removed++
+		result.Freed += e.info.Size()
+		result.Size -= e.info.Size()
+	}
+	return result, nil
+}
+
+// cacheEntries provides the files of the package cache, grouping the links to the same file
+func cacheEntries(cacheDir string) ([]*cacheEntry, error) {
+	var entries []*cacheEntry
+	bySize := make(map[int64][]*cacheEntry)
+	err := filepath.Walk(cacheDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == cacheDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() || !isCachedPackagePath(cacheDir, path) {
+			return nil
+		}
+		for _, e := range bySize[fi.Size()] {
+			if os.SameFile(e.info, fi) {
+				e.paths = append(e.paths, path)
+				return nil
+			}
+		}
+		e := &cacheEntry{paths: []string{path}, info: fi}
+		bySize[fi.Size()] = append(bySize[fi.Size()], e)
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// isCachedPackagePath checks whether a file of the package cache is a package, being within
+// <repo>/src, <repo>/binary/<R version> or the package store, rather than an unpacked tarball
+func isCachedPackagePath(cacheDir string, path string) bool {
+	rel, err := filepath.Rel(cacheDir, path)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	switch {
+	case parts[0] == "store":
+		return !strings.HasSuffix(path, ".tmp")
+	case len(parts) == 3 && parts[1] == "src":
+		return true
+	case len(parts) == 4 && parts[1] == "binary":
+		return true
+	}
+	return false
+}
+
+// CachedPackageName provides the <package>_<version> of a cached package file,
+// such as R6_2.5.0 from R6_2.5.0.tar.gz, R6_2.5.0.tgz or R6_2.5.0_R_x86_64-pc-linux-gnu.tar.gz
+func CachedPackageName(file string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		file = strings.TrimSuffix(file, ext)
+	}
+	if i := strings.Index(file, "_R_"); i >= 0 {
+		file = file[:i]
+	}
+	return file
+}
+
+// ParseSize parses a size in bytes, optionally with a K, M, G or T suffix
+// of powers of 1024, such as 20G or 512MB
+func ParseSize(s string) (int64, error) {
+	size := strings.ToUpper(strings.TrimSpace(s))
+	size = strings.TrimSuffix(strings.TrimSuffix(size, "B"), "I")
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(size, unit) {
+			multiplier = int64(1) << (10 * uint(i+1))
+			size = strings.TrimSuffix(size, unit)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes optionally followed by K, M, G or T", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ParseAge parses a duration as time.ParseDuration does, additionally
+// allowing days and weeks such as 30d or 2w
+func ParseAge(s string) (time.Duration, error) {
+	age := strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(age, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(age, suffix), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q, expected a duration such as 30d or 12h", s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q, expected a duration such as 30d or 12h", s)
+	}
+	return d, nil
+}
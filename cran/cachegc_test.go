@@ -0,0 +1,124 @@
+package cran
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected int64
+	}{
+		{"1024", 1024},
+		{"20G", 20 << 30},
+		{"20GB", 20 << 30},
+		{"20GiB", 20 << 30},
+		{"512m", 512 << 20},
+		{"1.5K", 1536},
+		{"2T", 2 << 40},
+	}
+	for _, tt := range tests {
+		actual, err := ParseSize(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.expected, actual, tt.in)
+	}
+	for _, in := range []string{"", "G", "twenty", "-1G"} {
+		_, err := ParseSize(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		actual, err := ParseAge(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.expected, actual, tt.in)
+	}
+	for _, in := range []string{"", "30", "d", "a month"} {
+		_, err := ParseAge(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestCachedPackageName(t *testing.T) {
+	for file, expected := range map[string]string{
+		"R6_2.5.0.tar.gz":                       "R6_2.5.0",
+		"R6_2.5.0.tgz":                          "R6_2.5.0",
+		"R6_2.5.0.zip":                          "R6_2.5.0",
+		"R6_2.5.0_R_x86_64-pc-linux-gnu.tar.gz": "R6_2.5.0",
+		"data.table_1.14.2.tar.gz":              "data.table_1.14.2",
+	} {
+		assert.Equal(t, expected, CachedPackageName(file), file)
+	}
+}
+
+func TestCollectCacheGarbage(t *testing.T) {
+	fs := afero.NewOsFs()
+	cacheDir := t.TempDir()
+	store := NewPackageStore(fs, cacheDir)
+	now := time.Now()
+	write := func(path string, size int, age time.Duration) string {
+		path = filepath.Join(cacheDir, path)
+		require.NoError(t, fs.MkdirAll(filepath.Dir(path), 0777))
+		require.NoError(t, afero.WriteFile(fs, path, make([]byte, size), 0644))
+		used := now.Add(-age)
+		require.NoError(t, os.Chtimes(path, used, used))
+		return path
+	}
+	// the same tarball from two repos is one file of the store
+	r6 := write("CRAN-abc/src/R6_2.5.0.tar.gz", 100, 40*24*time.Hour)
+	require.NoError(t, store.Put(r6, ""))
+	r6mpn := filepath.Join(cacheDir, "MPN-def", "src", "R6_2.5.0.tar.gz")
+	sum, err := FileMD5(fs, r6)
+	require.NoError(t, err)
+	require.True(t, store.Restore(sum, r6mpn))
+	old := now.Add(-40 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(r6, old, old))
+
+	cli := write("CRAN-abc/binary/4.2/cli_3.3.0_R_x86_64-pc-linux-gnu.tar.gz", 1000, 10*24*time.Hour)
+	rlang := write("CRAN-abc/src/rlang_1.0.2.tar.gz", 1000, 20*24*time.Hour)
+	dplyr := write("CRAN-abc/src/dplyr_1.0.9.tar.gz", 1000, 50*24*time.Hour)
+	glue := write("CRAN-abc/src/glue_1.6.2.tar.gz", 1000, time.Hour)
+	// unpacked tarballs are not cached packages
+	tarball := write("0a1b2c/mypkg/src/init.c", 5000, 100*24*time.Hour)
+
+	res, err := CollectCacheGarbage(cacheDir, CacheGCOptions{
+		OlderThan: 30 * 24 * time.Hour,
+		Protected: map[string]bool{"dplyr_1.0.9": true},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, CacheGCResult{Removed: 1, Freed: 100, Size: 4000}, res)
+	for _, p := range []string{r6, r6mpn, store.ObjectPath(sum)} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), p)
+	}
+
+	// the least recently used packages are removed first
+	TouchCached(fs, rlang)
+	res, err = CollectCacheGarbage(cacheDir, CacheGCOptions{
+		MaxSize:   2500,
+		Protected: map[string]bool{"dplyr_1.0.9": true},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, CacheGCResult{Removed: 2, Freed: 2000, Size: 2000}, res)
+	for p, kept := range map[string]bool{cli: false, glue: false, rlang: true, dplyr: true, tarball: true} {
+		_, err := os.Stat(p)
+		assert.Equal(t, kept, err == nil, p)
+	}
+}
@@ -0,0 +1,113 @@
+package cran
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Collision is a package available from more than one repo, where a repo other than
+// the intended one could provide it, eg an internal package name also published to CRAN
+type Collision struct {
+	Package string
+	// Pinned is set when the repo of the package is set with a Repo customization
+	Pinned  bool
+	Entries []CollisionEntry
+}
+
+// CollisionEntry is the version of a colliding package a repo provides
+type CollisionEntry struct {
+	Repo    string
+	Type    SourceType
+	Version string
+	MD5sum  string
+	// Selected is set for the entry the package database resolves the package to
+	Selected bool
+}
+
+// FindCollisions finds the packages available from more than one repo permitted
+// to provide them. Repos providing identical versions, with matching checksums,
+// are not considered to collide.
+func (pkgNexus *PkgNexus) FindCollisions(pkgs []string) []Collision {
+	var collisions []Collision
+	for _, pkg := range pkgs {
+		selected, cfg, _ := pkgNexus.GetPackage(pkg)
+		c := Collision{Package: pkg, Pinned: pkgNexus.Config.Packages[pkg].Repo.Name != ""}
+		signatures := make(map[string]string)
+		for _, db := range pkgNexus.Db {
+			if !pkgNexus.repoAllows(db.Repo, pkg) {
+				continue
+			}
+			var signature []string
+			for _, st := range []SourceType{Source, Binary} {
+				ds := db.DescriptionsBySourceType[st][pkg]
+				if len(ds) == 0 {
+					continue
+				}
+				d, ok := pkgNexus.selectVersion(ds)
+				if !ok {
+					d = ds[0]
+				}
+				c.Entries = append(c.Entries, CollisionEntry{
+					Repo:     db.Repo.Name,
+					Type:     st,
+					Version:  d.Version,
+					MD5sum:   d.MD5sum,
+					Selected: db.Repo.Name == cfg.Repo.Name && st == cfg.Type && d.Version == selected.Version,
+				})
+				// without a checksum the content cannot be known to be identical
+				md5 := d.MD5sum
+				if md5 == "" {
+					md5 = db.Repo.Name
+				}
+				signature = append(signature, fmt.Sprintf("%s %s %s", st, d.Version, md5))
+			}
+			if len(signature) > 0 {
+				signatures[db.Repo.Name] = strings.Join(signature, ",")
+			}
+		}
+		if len(signatures) < 2 || identicalSignatures(signatures) {
+			continue
+		}
+		collisions = append(collisions, c)
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Package < collisions[j].Package
+	})
+	return collisions
+}
+
+func identicalSignatures(signatures map[string]string) bool {
+	first := ""
+	for _, s := range signatures {
+		if first == "" {
+			first = s
+		} else if s != first {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteCollisions writes a table of the collisions, with the version and checksum
+// each repo provides. The entry used for the package is marked with a *
+func WriteCollisions(w io.Writer, collisions []Collision) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tREPO\tTYPE\tVERSION\tMD5SUM\tPINNED")
+	for _, c := range collisions {
+		for _, e := range c.Entries {
+			repo := e.Repo
+			if e.Selected {
+				repo = "*" + repo
+			}
+			md5 := e.MD5sum
+			if md5 == "" {
+				md5 = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\n", c.Package, repo, e.Type, e.Version, md5, c.Pinned)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,76 @@
+package cran
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCollisionNexus() *PkgNexus {
+	internal := newTestRepoDb(RepoURL{Name: "internal", URL: "https://rpkgs.example.com"},
+		desc.Desc{Package: "dplyr", Version: "9.9.9", MD5sum: "d0d0"},
+		desc.Desc{Package: "mirrored", Version: "1.0.0", MD5sum: "abab"},
+		desc.Desc{Package: "nochecksum", Version: "1.0.0"},
+		desc.Desc{Package: "pinned", Version: "2.0.0", MD5sum: "p2p2"},
+	)
+	cranDb := newTestRepoDb(RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"},
+		desc.Desc{Package: "dplyr", Version: "1.0.7", MD5sum: "c1c1"},
+		desc.Desc{Package: "mirrored", Version: "1.0.0", MD5sum: "abab"},
+		desc.Desc{Package: "nochecksum", Version: "1.0.0"},
+		desc.Desc{Package: "pinned", Version: "1.0.0", MD5sum: "p1p1"},
+		desc.Desc{Package: "cranonly", Version: "1.0.0", MD5sum: "c0c0"},
+	)
+	return newTestNexus(internal, cranDb)
+}
+
+func TestFindCollisions(t *testing.T) {
+	pkgNexus := newTestCollisionNexus()
+	require.NoError(t, pkgNexus.SetPackageRepo("pinned", "CRAN"))
+	pkgs := []string{"dplyr", "mirrored", "nochecksum", "pinned", "cranonly"}
+
+	collisions := pkgNexus.FindCollisions(pkgs)
+	assert.Equal(t, []Collision{
+		{
+			Package: "dplyr",
+			Entries: []CollisionEntry{
+				{Repo: "internal", Type: Source, Version: "9.9.9", MD5sum: "d0d0", Selected: true},
+				{Repo: "CRAN", Type: Source, Version: "1.0.7", MD5sum: "c1c1"},
+			},
+		},
+		{
+			Package: "nochecksum",
+			Entries: []CollisionEntry{
+				{Repo: "internal", Type: Source, Version: "1.0.0", Selected: true},
+				{Repo: "CRAN", Type: Source, Version: "1.0.0"},
+			},
+		},
+		{
+			Package: "pinned",
+			Pinned:  true,
+			Entries: []CollisionEntry{
+				{Repo: "internal", Type: Source, Version: "2.0.0", MD5sum: "p2p2"},
+				{Repo: "CRAN", Type: Source, Version: "1.0.0", MD5sum: "p1p1", Selected: true},
+			},
+		},
+	}, collisions)
+
+	// repos not permitted to provide a package do not collide
+	pkgNexus.Config.Repos["internal"] = RepoConfig{Exclude: []string{"dplyr"}}
+	collisions = pkgNexus.FindCollisions([]string{"dplyr"})
+	assert.Empty(t, collisions)
+}
+
+func TestWriteCollisions(t *testing.T) {
+	pkgNexus := newTestCollisionNexus()
+	var buf bytes.Buffer
+	require.NoError(t, WriteCollisions(&buf, pkgNexus.FindCollisions([]string{"dplyr", "nochecksum"})))
+	assert.Equal(t, `PACKAGE     REPO       TYPE    VERSION  MD5SUM  PINNED
+dplyr       *internal  source  9.9.9    d0d0    false
+dplyr       CRAN       source  1.0.7    c1c1    false
+nochecksum  *internal  source  1.0.0    -       false
+nochecksum  CRAN       source  1.0.0    -       false
+`, buf.String())
+}
@@ -0,0 +1,95 @@
+package cran
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+)
+
+// Add registers a version requirement for a package, deps without a
+// version constraint are ignored as any version satisfies them.
+// The requirements for a package are kept sorted so sets of constraints
+// can be compared regardless of the order they were discovered in
+func (pc PkgConstraints) Add(dep desc.Dep, requiredBy string) {
+	if dep.Constraint == desc.None {
+		return
+	}
+	nc := PkgConstraint{Dep: dep, RequiredBy: requiredBy}
+	for _, c := range pc[dep.Name] {
+		if c == nc {
+			return
+		}
+	}
+	cs := append(pc[dep.Name], nc)
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].RequiredBy != cs[j].RequiredBy {
+			return cs[i].RequiredBy < cs[j].RequiredBy
+		}
+		return cs[i].Dep.ToString() < cs[j].Dep.ToString()
+	})
+	pc[dep.Name] = cs
+}
+
+// Copy provides a copy of the constraints that can be modified independently
+func (pc PkgConstraints) Copy() PkgConstraints {
+	cp := make(PkgConstraints)
+	for pkg, cs := range pc {
+		cp[pkg] = append([]PkgConstraint{}, cs...)
+	}
+	return cp
+}
+
+// Equal checks whether both sets contain the same requirements
+func (pc PkgConstraints) Equal(other PkgConstraints) bool {
+	if len(pc) != len(other) {
+		return false
+	}
+	for pkg, cs := range pc {
+		ocs, ok := other[pkg]
+		if !ok || len(cs) != len(ocs) {
+			return false
+		}
+		for i := range cs {
+			if cs[i] != ocs[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsSatisfiedBy checks whether the version of the package meets
+// every requirement registered for it
+func (pc PkgConstraints) IsSatisfiedBy(d desc.Desc) bool {
+	cs, ok := pc[d.Package]
+	if !ok {
+		return true
+	}
+	v := desc.ParseVersion(d.Version)
+	for _, c := range cs {
+		if !c.Dep.IsSatisfiedBy(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ToString provides the requirements in the form
+// <Name> (<constraint> <version>) required by <requiredBy>
+func (c PkgConstraint) ToString() string {
+	return fmt.Sprintf("%s required by %s", c.Dep.ToString(), c.RequiredBy)
+}
+
+func (e *ConstraintError) Error() string {
+	var cs []string
+	for _, c := range e.Constraints {
+		cs = append(cs, c.ToString())
+	}
+	return fmt.Sprintf("no available version of %s satisfies: %s; available versions: %s",
+		e.Package,
+		strings.Join(cs, ", "),
+		strings.Join(e.Available, ", "),
+	)
+}
@@ -0,0 +1,229 @@
+package cran
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	log "github.com/sirupsen/logrus"
+)
+
+// repoDbCacheVersion is the version of the layout of cached repo databases,
+// to be incremented whenever the header or the encoding of the descriptions changes
+const repoDbCacheVersion = 1
+
+// RepoDbCacheHeader describes the contents of a cached repo database, and is
+// written ahead of the descriptions so a cache can be identified without decoding them
+type RepoDbCacheHeader struct {
+	Version int
+	// Schema is the layout of desc.Desc the descriptions were written with
+	Schema      string
+	Repo        string
+	URL         string
+	BinaryURL   string
+	SourceTypes []SourceType
+	// Packages is the number of packages of each source type
+	Packages map[SourceType]int
+	RVersion string
+	Platform string
+	Fetched  time.Time
+}
+
+// RepoDbCache is a repo database found in the cache directory
+type RepoDbCache struct {
+	File    string
+	ModTime time.Time
+	Size    int64
+	Header  RepoDbCacheHeader
+	// Err is set when the cache cannot be read by this version of pkgr
+	Err error
+}
+
+// descSchema is the layout of desc.Desc, so descriptions cached before a change to it are discarded
+var descSchema = typeSchema(reflect.TypeOf(desc.Desc{}))
+
+// typeSchema describes the names and types of the fields of a struct type, including those of nested structs
+func typeSchema(t reflect.Type) string {
+	for t.Kind() == reflect.Map || t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return t.String()
+	}
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fields = append(fields, fmt.Sprintf("%s %s", f.Name, f.Type))
+		if s := typeSchema(f.Type); strings.HasPrefix(s, "{") {
+			fields = append(fields, s)
+		}
+	}
+	return "{" + strings.Join(fields, ";") + "}"
+}
+
+// newRepoDbCacheHeader describes the repo database as cached for the R version
+func (repoDb *RepoDb) newRepoDbCacheHeader(rVersion RVersion) RepoDbCacheHeader {
+	h := RepoDbCacheHeader{
+		Version:   repoDbCacheVersion,
+		Schema:    descSchema,
+		Repo:      repoDb.Repo.Name,
+		URL:       repoDb.Repo.URL,
+		BinaryURL: repoDb.Repo.BinaryURL,
+		Packages:  make(map[SourceType]int),
+		RVersion:  rVersion.ToFullString(),
+		Fetched:   repoDb.Time,
+	}
+	if _, ok := repoDb.DescriptionsBySourceType[Binary]; ok && repoDb.Platform.OS != "" {
+		h.Platform = repoDb.Platform.String()
+		if distro := getLinuxBinaryUri(repoDb.Platform); distro != "" {
+			h.Platform += " " + distro
+		}
+	}
+	for st, descriptions := range repoDb.DescriptionsBySourceType {
+		h.SourceTypes = append(h.SourceTypes, st)
+		h.Packages[st] = len(descriptions)
+	}
+	sort.Slice(h.SourceTypes, func(i, j int) bool { return h.SourceTypes[i] < h.SourceTypes[j] })
+	return h
+}
+
+// compatible checks whether the cache was written by this version of pkgr
+func (h RepoDbCacheHeader) compatible() error {
+	if h.Version != repoDbCacheVersion {
+		return fmt.Errorf("cache version %d, expected %d", h.Version, repoDbCacheVersion)
+	}
+	if h.Schema != descSchema {
+		return fmt.Errorf("cached package descriptions have a different layout")
+	}
+	return nil
+}
+
+// decodeRepoDbCacheHeader reads the header from the start of a cached repo database,
+// failing for caches written without one by older versions of pkgr
+func decodeRepoDbCacheHeader(d *gob.Decoder) (RepoDbCacheHeader, error) {
+	var h RepoDbCacheHeader
+	if err := d.Decode(&h); err != nil {
+		return h, fmt.Errorf("unreadable cache header: %s", err)
+	}
+	return h, h.compatible()
+}
+
+// ReadRepoDbCacheHeader reads the header of a cached repo database
+func ReadRepoDbCacheHeader(file string) (RepoDbCacheHeader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return RepoDbCacheHeader{}, err
+	}
+	defer f.Close()
+	return decodeRepoDbCacheHeader(gob.NewDecoder(f))
+}
+
+// discardUnreadableCache removes a cached repo database that could not be read,
+// along with its validators, so it is fetched again
+func discardUnreadableCache(r RepoURL, file string, err error) {
+	log.WithFields(log.Fields{
+		"repo":  r.Name,
+		"file":  file,
+		"error": err,
+	}).Info("discarding unreadable cached packages database")
+	os.Remove(file)
+	os.Remove(validatorsFilePath(file))
+}
+
+// RepoDbCacheDir provides the directory repo databases are cached in
+func RepoDbCacheDir() string {
+	cdir, err := os.UserCacheDir()
+	if err != nil {
+		fmt.Println("could not use user cache dir, using temp dir")
+		cdir = os.TempDir()
+	}
+	return filepath.Join(cdir, "pkgr", "r_packagedb_caches")
+}
+
+// ListRepoDbCaches provides the repo databases cached in dir, ordered by repo name
+// then R version. Caches which cannot be read are included with Err set.
+func ListRepoDbCaches(dir string) ([]RepoDbCache, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var caches []RepoDbCache
+	for _, fi := range files {
+		if fi.IsDir() || strings.HasSuffix(fi.Name(), ".validators") || strings.HasSuffix(fi.Name(), ".tmp") {
+			continue
+		}
+		c := RepoDbCache{File: filepath.Join(dir, fi.Name()), ModTime: fi.ModTime(), Size: fi.Size()}
+		c.Header, c.Err = ReadRepoDbCacheHeader(c.File)
+		caches = append(caches, c)
+	}
+	sort.SliceStable(caches, func(i, j int) bool {
+		if caches[i].Header.Repo != caches[j].Header.Repo {
+			return caches[i].Header.Repo < caches[j].Header.Repo
+		}
+		return caches[i].Header.RVersion < caches[j].Header.RVersion
+	})
+	return caches, nil
+}
+
+// WriteRepoDbCaches writes a table of cached repo databases and their age,
+// being the time since the repo was last checked for changes
+func WriteRepoDbCaches(w io.Writer, caches []RepoDbCache, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tURL\tR\tTYPES\tPACKAGES\tAGE\tFILE")
+	for _, c := range caches {
+		age := now.Sub(c.ModTime).Round(time.Second)
+		if c.Err != nil {
+			fmt.Fprintf(tw, "-\t-\t-\t-\t-\t%s\t%s (%s)\n", age, filepath.Base(c.File), c.Err)
+			continue
+		}
+		var types []string
+		packages := 0
+		for _, st := range c.Header.SourceTypes {
+			types = append(types, st.String())
+			packages += c.Header.Packages[st]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", c.Header.Repo, c.Header.URL, c.Header.RVersion,
+			strings.Join(types, ","), packages, age, filepath.Base(c.File))
+	}
+	return tw.Flush()
+}
+
+// WriteRepoDbCache writes the details of a cached repo database
+func WriteRepoDbCache(w io.Writer, c RepoDbCache, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "File:\t%s\n", c.File)
+	fmt.Fprintf(tw, "Size:\t%.2f MB\n", float64(c.Size)/(1024*1024))
+	fmt.Fprintf(tw, "Age:\t%s\n", now.Sub(c.ModTime).Round(time.Second))
+	if c.Err != nil {
+		fmt.Fprintf(tw, "Error:\t%s\n", c.Err)
+		return tw.Flush()
+	}
+	h := c.Header
+	fmt.Fprintf(tw, "Repo:\t%s\n", h.Repo)
+	fmt.Fprintf(tw, "URL:\t%s\n", h.URL)
+	if h.BinaryURL != "" {
+		fmt.Fprintf(tw, "Binary URL:\t%s\n", h.BinaryURL)
+	}
+	fmt.Fprintf(tw, "R Version:\t%s\n", h.RVersion)
+	if h.Platform != "" {
+		fmt.Fprintf(tw, "Platform:\t%s\n", h.Platform)
+	}
+	fmt.Fprintf(tw, "Fetched:\t%s\n", h.Fetched.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Cache Version:\t%d\n", h.Version)
+	for _, st := range h.SourceTypes {
+		fmt.Fprintf(tw, "Packages (%s):\t%d\n", st, h.Packages[st])
+	}
+	return tw.Flush()
+}
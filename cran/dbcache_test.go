@@ -0,0 +1,113 @@
+package cran
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoDbCacheHeader(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+	rv := RVersion{Major: 4, Minor: 2, Patch: 1}
+	fetched := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	db := &RepoDb{
+		DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{
+			Source: {"pkgA": {{Package: "pkgA", Version: "1.0.0"}}, "pkgB": {{Package: "pkgB", Version: "2.0.0"}}},
+			Binary: {"pkgA": {{Package: "pkgA", Version: "1.0.0"}}},
+		},
+		Repo:     RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"},
+		Platform: Platform{OS: "windows", Arch: "x86_64", Vendor: "w64"},
+		Time:     fetched,
+	}
+	require.NoError(t, db.Encode(file, rv))
+
+	h, err := ReadRepoDbCacheHeader(file)
+	require.NoError(t, err)
+	assert.Equal(t, "CRAN", h.Repo)
+	assert.Equal(t, "https://cran.r-project.org", h.URL)
+	assert.Equal(t, "4.2.1", h.RVersion)
+	assert.Equal(t, "x86_64-w64-mingw32", h.Platform)
+	assert.Equal(t, []SourceType{Source, Binary}, h.SourceTypes)
+	assert.Equal(t, map[SourceType]int{Source: 2, Binary: 1}, h.Packages)
+	assert.True(t, fetched.Equal(h.Fetched))
+
+	decoded := &RepoDb{Repo: db.Repo}
+	require.NoError(t, decoded.Decode(file))
+	assert.Equal(t, db.DescriptionsBySourceType, decoded.DescriptionsBySourceType)
+	assert.True(t, fetched.Equal(decoded.Time))
+
+	other := &RepoDb{Repo: RepoURL{Name: "CRAN", URL: "https://cran.rstudio.com"}}
+	assert.Error(t, other.Decode(file))
+}
+
+func TestRepoDbCacheIncompatible(t *testing.T) {
+	dir := t.TempDir()
+	// written by a version of pkgr without the header
+	legacy := filepath.Join(dir, "legacy")
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(map[SourceType]map[string][]desc.Desc{Source: {}}))
+	require.NoError(t, ioutil.WriteFile(legacy, buf.Bytes(), 0644))
+	corrupt := filepath.Join(dir, "corrupt")
+	require.NoError(t, ioutil.WriteFile(corrupt, []byte("not a cache"), 0644))
+	newer := filepath.Join(dir, "newer")
+	buf.Reset()
+	require.NoError(t, gob.NewEncoder(&buf).Encode(RepoDbCacheHeader{Version: repoDbCacheVersion + 1, Schema: descSchema}))
+	require.NoError(t, ioutil.WriteFile(newer, buf.Bytes(), 0644))
+
+	for _, file := range []string{legacy, corrupt, newer} {
+		_, err := ReadRepoDbCacheHeader(file)
+		assert.Error(t, err, file)
+		assert.Error(t, (&RepoDb{}).Decode(file), file)
+	}
+
+	caches, err := ListRepoDbCaches(dir)
+	require.NoError(t, err)
+	require.Len(t, caches, 3)
+	for _, c := range caches {
+		assert.Error(t, c.Err, c.File)
+	}
+}
+
+func TestFetchPackagesDiscardsIncompatibleCache(t *testing.T) {
+	os.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	dir := t.TempDir()
+	contrib := filepath.Join(dir, "src", "contrib")
+	require.NoError(t, os.MkdirAll(contrib, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(contrib, "PACKAGES"), []byte("Package: pkgA\nVersion: 1.0.0\n"), 0644))
+
+	rv := RVersion{Major: 4, Minor: 1, Patch: 2}
+	newDb := func() *RepoDb {
+		return &RepoDb{
+			DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+			Repo:                     RepoURL{Name: "internal", URL: dir},
+		}
+	}
+	db := newDb()
+	cacheFile := db.GetRepoDbCacheFilePath(rv.ToFullString())
+	require.NoError(t, os.MkdirAll(filepath.Dir(cacheFile), 0755))
+	require.NoError(t, ioutil.WriteFile(cacheFile, []byte("not a cache"), 0644))
+
+	require.NoError(t, db.FetchPackages(rv, false))
+	assert.Len(t, db.DescriptionsBySourceType[Source]["pkgA"], 1)
+	h, err := ReadRepoDbCacheHeader(cacheFile)
+	require.NoError(t, err)
+	assert.Equal(t, "internal", h.Repo)
+
+	caches, err := ListRepoDbCaches(RepoDbCacheDir())
+	require.NoError(t, err)
+	require.Len(t, caches, 1)
+	var out bytes.Buffer
+	require.NoError(t, WriteRepoDbCaches(&out, caches, caches[0].ModTime.Add(90*time.Second)))
+	assert.Contains(t, out.String(), "REPO")
+	assert.Contains(t, out.String(), "internal")
+	assert.Contains(t, out.String(), "1m30s")
+}
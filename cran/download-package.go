@@ -1,11 +1,8 @@
 package cran
 
 import (
-	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,25 +23,34 @@ func (r RepoType) String() string {
 	if r == RSPM {
 		return "rspm"
 	}
+	if r == BIOCONDUCTOR {
+		return "bioconductor"
+	}
 	return "cran"
 }
 
 const (
-	CRAN = 10
-	MPN  = 11
-	RSPM = 12
+	CRAN         = 10
+	MPN          = 11
+	RSPM         = 12
+	BIOCONDUCTOR = 13
 )
 
 // SourceType represents the type of package to download
 type SourceType int
 
+// String provides the name of the source type. Default is not resolved, as the type
+// it stands for depends on the platform planned for, see DefaultType
 func (s SourceType) String() string {
 	if s == Default {
-		s = DefaultType()
+		return "default"
 	}
 	if s == Binary {
 		return "binary"
 	}
+	if s == Both {
+		return "both"
+	}
 	return "source"
 }
 
@@ -57,6 +63,9 @@ const (
 	Default SourceType = iota
 	Source
 	Binary
+	// Both prefers binaries, falling back to source where no binary is available,
+	// like type = "both" for install.packages in R
+	Both
 )
 
 func getRepos(ds []PkgDl) map[string]RepoURL {
@@ -67,15 +76,23 @@ func getRepos(ds []PkgDl) map[string]RepoURL {
 	return rpm
 }
 
-// DownloadPackages downloads a set of packages concurrently
-// noSecure will allow https fetching without validating the certificate chain.
-// This occasionally is needed for repos that have self signed or certs not fully verifiable
-// which will return errors such as x509: certificate signed by unknown authority
-func DownloadPackages(fs afero.Fs, ds []PkgDl, baseDir string, rv RVersion, noSecure bool) (*PkgMap, error) {
+// DownloadPackages downloads a set of packages concurrently, returning an error
+// if any package could not be downloaded
+// noSecure skips validating the certificate chain, see NewPkgDb.
+// skipVerify disables checking downloads against the checksums in the repo index,
+// for repos that do not publish them correctly.
+// offline only resolves packages already present in the cache, returning an error
+// listing every package missing from the cache rather than downloading them.
+// Binaries are those for the R version rv on platform p.
+// Packages are kept in the content addressed PackageStore of baseDir, so a package
+// with the same checksum as one resolved from another repo is linked rather than downloaded.
+func DownloadPackages(fs afero.Fs, ds []PkgDl, baseDir string, rv RVersion, p Platform, noSecure bool, skipVerify bool, offline bool) (*PkgMap, error) {
 	startTime := time.Now()
 	result := NewPkgMap()
 	sem := make(chan struct{}, 10)
 	wg := sync.WaitGroup{}
+	var dlErrs []error
+	var errMutex sync.Mutex
 	rpm := getRepos(ds)
 	for _, r := range rpm {
 		urlHash := RepoURLHash(r)
@@ -88,44 +105,44 @@ func DownloadPackages(fs afero.Fs, ds []PkgDl, baseDir string, rv RVersion, noSe
 			}
 		}
 	}
+	// packages already stored from another repo only need linking into the layout of this one
+	store := NewPackageStore(fs, baseDir)
+	for _, d := range ds {
+		if d.Config.Type == Default {
+			d.Config.Type = DefaultType(p)
+		}
+		if sum := verifiedMD5(d, skipVerify); sum != "" && store.Restore(sum, packageCachePath(d, baseDir, rv, p)) {
+			log.WithFields(log.Fields{
+				"package": d.Package.Package,
+				"repo":    d.Config.Repo.Name,
+			}).Debug("package found in package store")
+		}
+	}
+	if offline {
+		if missing := missingFromCache(fs, ds, baseDir, rv, p); len(missing) > 0 {
+			return result, fmt.Errorf("offline and %d package(s) missing from the package cache: %s", len(missing), strings.Join(missing, ", "))
+		}
+	}
 	log.WithField("dir", baseDir).Info("downloading required packages within directory ")
 	for _, d := range ds {
 		wg.Add(1)
 		go func(d PkgDl, wg *sync.WaitGroup) {
-			var pkgType string
 			if d.Config.Type == Default {
-				d.Config.Type = DefaultType()
-			}
-			switch d.Config.Type {
-			case Binary:
-				pkgType = "binary"
-			case Source:
-				pkgType = "src"
-			default:
-				pkgType = "src"
+				d.Config.Type = DefaultType(p)
 			}
 			sem <- struct{}{}
 			defer func() {
 				<-sem
 				wg.Done()
 			}()
-			// TODO: should potentially provide a lookup mapping
-			// but would want to do this outside the goroutine that downloads\
-			// the package so didn't get invoked multiple times
-			urlHash := RepoURLHash(d.Config.Repo)
-			pkgdir := filepath.Join(baseDir, urlHash, pkgType)
-			var pkgFile string
-			if d.Config.Type == Binary {
-				pkgFile = filepath.Join(pkgdir, rv.ToString(), binaryName(d.Package.Package, d.Package.Version))
-			} else {
-				pkgFile = filepath.Join(pkgdir, fmt.Sprintf("%s_%s.tar.gz", d.Package.Package, d.Package.Version))
-			}
+			pkgFile := packageCachePath(d, baseDir, rv, p)
 			startDl := time.Now()
-			dl, err := DownloadPackage(fs, d, pkgFile, rv, noSecure)
+			dl, err := DownloadPackage(fs, d, pkgFile, rv, p, noSecure, skipVerify, offline)
 			if err != nil {
-				// TODO:  should this cause a failure downstream rather than just printing
-				// as right now it keeps running and just doesn't install that package?
-				log.WithField("package", d.Package.Package).Warn("downloading failed")
+				log.WithField("package", d.Package.Package).Error(err)
+				errMutex.Lock()
+				dlErrs = append(dlErrs, err)
+				errMutex.Unlock()
 				return
 			}
 
@@ -135,22 +152,53 @@ func DownloadPackages(fs afero.Fs, ds []PkgDl, baseDir string, rv RVersion, noSe
 					"dltime":  time.Since(startDl),
 					"size":    fmt.Sprintf("%.2f MB", dl.GetMegabytes()),
 				}).Debug("download successful")
+				if len(d.Config.Repo.Mirrors) > 0 {
+					log.WithFields(log.Fields{
+						"package": d.Package.Package,
+						"repo":    d.Config.Repo.Name,
+						"mirror":  dl.Mirror,
+					}).Info("downloaded from mirror")
+				}
+			}
+			sum := verifiedMD5(d, skipVerify)
+			if dl.Metadata.Config.Type != d.Config.Type {
+				// a source package served in place of the binary
+				sum = ""
+			}
+			if dl.New || sum != "" {
+				if err := store.Put(dl.Path, sum); err != nil {
+					log.WithFields(log.Fields{
+						"package": d.Package.Package,
+						"error":   err,
+					}).Warn("could not add package to the package store")
+				}
 			}
+			TouchCached(fs, dl.Path)
 			result.Put(d.Package.Package, dl)
 		}(d, &wg)
 	}
 	wg.Wait()
+	// installing without every package would not match the plan, and a package
+	// not matching the checksum of the index is either corrupt or has been tampered with
+	if len(dlErrs) > 0 {
+		return result, fmt.Errorf("%d package(s) failed to download, first error: %s", len(dlErrs), dlErrs[0])
+	}
 	log.WithField("duration", time.Since(startTime)).Info("all packages downloaded")
 	return result, nil
 }
 
 // DownloadPackage should download a package tarball if it doesn't exist and return
-// the path to the downloaded tarball
+// the path to the downloaded tarball. The tarball is only moved to dest once fully
+// downloaded, and failures are returned as a DownloadError.
+//
+// noSecure skips validating the certificate chain, see NewPkgDb.
 //
-// noSecure will allow https fetching without validating the certificate chain.
-// This occasionally is needed for repos that have self signed or certs not fully verifiable
-// which will return errors such as x509: certificate signed by unknown authority
-func DownloadPackage(fs afero.Fs, d PkgDl, dest string, rv RVersion, noSecure bool) (Download, error) {
+// Unless skipVerify is set, the tarball is checked against the MD5sum/SHA256 from the repo index,
+// removing it and returning a ChecksumError on mismatch. Previously downloaded
+// tarballs failing the check are downloaded again, unless offline. The index of a repo with
+// a BinaryURL only has checksums for the source packages, so binaries served from it are
+// only checked against the size and md5 sum reported by the server, if any.
+func DownloadPackage(fs afero.Fs, d PkgDl, dest string, rv RVersion, p Platform, noSecure bool, skipVerify bool, offline bool) (Download, error) {
 	if !filepath.IsAbs(dest) {
 		cwd, _ := os.Getwd()
 		// turn to absolute
@@ -160,6 +208,40 @@ func DownloadPackage(fs afero.Fs, d PkgDl, dest string, rv RVersion, noSecure bo
 	if err != nil {
 		return Download{}, err
 	}
+	// the index of a repo serving binaries by the name of the source package is shared by both,
+	// so there are no checksums to verify the binaries against
+	servesBinary := d.Config.Type == Binary && d.Config.Repo.BinaryURL != ""
+	if servesBinary && !skipVerify {
+		log.WithFields(log.Fields{
+			"package": d.Package.Package,
+			"repo":    d.Config.Repo.Name,
+		}).Debug("no checksums in the repo index for binaries, only checking the size and checksum reported by the server")
+	}
+	if exists && !skipVerify && !servesBinary {
+		if err := verifyChecksums(fs, dest, d.Package); err != nil {
+			if offline {
+				return Download{Metadata: d}, err
+			}
+			log.WithFields(log.Fields{
+				"package": d.Package.Package,
+				"error":   err,
+			}).Warn("previously downloaded package failed verification, downloading again")
+			if err := fs.Remove(dest); err != nil {
+				return Download{}, err
+			}
+			exists = false
+		}
+	}
+	if !exists && servesBinary {
+		// a source package previously served in place of the binary
+		if srcDest := binaryFallbackPath(dest, d); srcDest != "" {
+			if ok, _ := goutils.Exists(fs, srcDest); ok {
+				d.Config.Type = Source
+				dest = srcDest
+				exists = true
+			}
+		}
+	}
 	if exists {
 		log.WithField("package", d.Package.Package).Debug("package already downloaded ")
 		return Download{
@@ -169,81 +251,47 @@ func DownloadPackage(fs afero.Fs, d PkgDl, dest string, rv RVersion, noSecure bo
 			Size:     0,
 		}, nil
 	}
+	if offline {
+		return Download{Metadata: d}, fmt.Errorf("offline and package %s not in the package cache at %s", d.Package.Package, dest)
+	}
 	var pkgdl string
 	if d.Config.Type == Source {
-		pkgdl = fmt.Sprintf("%s/src/contrib/%s", strings.TrimSuffix(d.Config.Repo.URL, "/"), filepath.Base(dest))
-	} else if d.Config.Repo.Suffix != "" {
-		pkgdl = fmt.Sprintf("%s/bin/%s/%s/contrib/%s/%s",
-			strings.TrimSuffix(d.Config.Repo.URL, "/"),
-			cranBinaryURL(rv),
-			d.Config.Repo.Suffix,
-			rv.ToString(),
-			filepath.Base(dest))
+		pkgdl = sourcePackageURL(d.Config.Repo, d.Package.Path, filepath.Base(dest))
+	} else if d.Config.Repo.BinaryURL != "" {
+		// binaries are served under the name of the source package
+		pkgdl = sourcePackageURL(RepoURL{URL: d.Config.Repo.BinaryURL}, d.Package.Path, fmt.Sprintf("%s_%s.tar.gz", d.Package.Package, d.Package.Version))
 	} else {
-		pkgdl = fmt.Sprintf("%s/bin/%s/contrib/%s/%s",
-			strings.TrimSuffix(d.Config.Repo.URL, "/"),
-			cranBinaryURL(rv),
-			rv.ToString(),
-			filepath.Base(dest))
+		pkgdl = binaryPackageURL(d.Config.Repo, rv, p, d.Package.Path, filepath.Base(dest))
 	}
 	log.Trace(pkgdl)
 
 	log.WithField("package", d.Package.Package).Info("downloading package ")
-	var from io.ReadCloser
-
-	client := &http.Client{}
-	if noSecure {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify : true},
-		}
-		client = &http.Client{Transport: tr}
-	}
-
-	if strings.HasPrefix(pkgdl, "http") {
-		resp, err := client.Get(pkgdl)
-		// TODO: the response will often be valid, but return like a server 404 or other error
-		if err != nil {
-			log.WithField("package", d.Package).Warn("error downloading package")
-			return Download{Metadata: d}, err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			log.WithFields(log.Fields{
-				"package":     d.Package.Package,
-				"url":         pkgdl,
-				"status":      resp.Status,
-				"status_code": resp.StatusCode,
-			}).Warn("bad server response")
-			b, _ := ioutil.ReadAll(resp.Body)
-			log.WithField("package", d.Package.Package).Println("body: ", string(b))
-			return Download{Metadata: d}, err
-		}
-		from = resp.Body
-		// not sure if we need to close both from and resp.Body but shouldn't be problematic to call twice just in case
-		defer from.Close()
-	} else {
-		from, err = fs.Open(pkgdl)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"package": d.Package.Package,
-				"path":    pkgdl,
-			}).Fatal("missing package")
-		}
-		defer from.Close()
-	}
-
-	file, err := fs.Create(dest)
-	if err != nil {
+	size, served, err := downloadFromMirrors(fs, d.Config.Repo, pkgdl, dest, noSecure)
+	if errors.Is(err, ErrNotFound) && d.Config.Type == Source && d.Package.Path == "" {
+		// the repo index may be out of date with a newer version having been released,
+		// at which point the version in the index is moved to the archive of the repo
+		archived := sourcePackageURL(d.Config.Repo, archivePath(d.Package.Package), filepath.Base(dest))
 		log.WithFields(log.Fields{
-			"package": d.Package,
-			"err":     err,
-		}).Warn("error downloading package, no tarball created")
-		return Download{}, err
+			"package": d.Package.Package,
+			"url":     archived,
+		}).Debug("package not found, checking repo archive")
+		size, served, err = downloadFromMirrors(fs, d.Config.Repo, archived, dest, noSecure)
 	}
-	defer file.Close()
-	size, err := io.Copy(file, from)
 	if err != nil {
-		return Download{Metadata: d}, err
+		return Download{Metadata: d}, &DownloadError{Package: d.Package.Package, URL: pkgdl, Err: err}
+	}
+	mirror := d.Config.Repo.mirrorBase(served)
+	if servesBinary {
+		dl, err := servedPackage(fs, d, dest, size)
+		dl.Mirror = mirror
+		return dl, err
+	}
+	if !skipVerify {
+		if err := verifyChecksums(fs, dest, d.Package); err != nil {
+			// never leave a bad tarball in the cache
+			fs.Remove(dest)
+			return Download{Metadata: d}, err
+		}
 	}
 
 	return Download{
@@ -251,5 +299,70 @@ func DownloadPackage(fs afero.Fs, d PkgDl, dest string, rv RVersion, noSecure bo
 		New:      true,
 		Metadata: d,
 		Size:     size,
+		Mirror:   mirror,
 	}, nil
 }
+
+// sourcePackageURL provides the url of a source package tarball, path being the
+// subdirectory of src/contrib the package is located in, if any
+func sourcePackageURL(r RepoURL, path string, tarball string) string {
+	if path != "" {
+		return fmt.Sprintf("%s/src/contrib/%s/%s", strings.TrimSuffix(r.URL, "/"), strings.Trim(path, "/"), tarball)
+	}
+	return fmt.Sprintf("%s/src/contrib/%s", strings.TrimSuffix(r.URL, "/"), tarball)
+}
+
+// binaryPackageURL provides the url of a binary package for the R version and platform, path being the
+// subdirectory of the contrib directory the package is located in, if any
+func binaryPackageURL(r RepoURL, rv RVersion, p Platform, path string, file string) string {
+	contrib := fmt.Sprintf("%s/bin/%s/contrib/%s", strings.TrimSuffix(r.URL, "/"), cranBinaryURL(rv, p), rv.ToString())
+	if r.Suffix != "" {
+		contrib = fmt.Sprintf("%s/bin/%s/%s/contrib/%s", strings.TrimSuffix(r.URL, "/"), cranBinaryURL(rv, p), r.Suffix, rv.ToString())
+	}
+	if path != "" {
+		return fmt.Sprintf("%s/%s/%s", contrib, strings.Trim(path, "/"), file)
+	}
+	return fmt.Sprintf("%s/%s", contrib, file)
+}
+
+// packageCachePath provides the location within the package cache a package is downloaded to
+func packageCachePath(d PkgDl, baseDir string, rv RVersion, p Platform) string {
+	st := d.Config.Type
+	if st == Default {
+		st = DefaultType(p)
+	}
+	pkgdir := filepath.Join(baseDir, RepoURLHash(d.Config.Repo))
+	if st == Binary {
+		return filepath.Join(pkgdir, "binary", rv.ToString(), binaryName(d.Package.Package, d.Package.Version, p))
+	}
+	return filepath.Join(pkgdir, "src", fmt.Sprintf("%s_%s.tar.gz", d.Package.Package, d.Package.Version))
+}
+
+// missingFromCache describes each package not yet present in the package cache
+// in the form <pkg>_<version> (<repo>, <type>)
+func missingFromCache(fs afero.Fs, ds []PkgDl, baseDir string, rv RVersion, p Platform) []string {
+	var missing []string
+	for _, d := range ds {
+		dest := packageCachePath(d, baseDir, rv, p)
+		if exists, _ := goutils.Exists(fs, dest); !exists {
+			if d.Config.Type == Binary && d.Config.Repo.BinaryURL != "" {
+				if ok, _ := goutils.Exists(fs, binaryFallbackPath(dest, d)); ok {
+					continue
+				}
+			}
+			missing = append(missing, fmt.Sprintf("%s_%s (%s, %s)", d.Package.Package, d.Package.Version, d.Config.Repo.Name, d.Config.Type))
+		}
+	}
+	return missing
+}
+
+// verifiedMD5 provides the md5 sum a downloaded package is verified against, if any,
+// being the key of the package in the package store
+func verifiedMD5(d PkgDl, skipVerify bool) string {
+	// the index of a repo serving binaries by the name of the source package
+	// only has the checksums of the source packages
+	if skipVerify || (d.Config.Type == Binary && d.Config.Repo.BinaryURL != "") {
+		return ""
+	}
+	return d.Package.MD5sum
+}
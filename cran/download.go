@@ -0,0 +1,202 @@
+package cran
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// maxDownloadAttempts is the number of times a download is attempted
+// before giving up on transient errors
+const maxDownloadAttempts = 4
+
+// downloadBackoff is the delay before the first retry of a download,
+// doubling with each subsequent attempt
+var downloadBackoff = time.Second
+
+// HTTPStatusError is returned when a repository responds with a status
+// that does not provide the requested file
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed fetching %s with status %s", e.URL, e.Status)
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode >= 500 ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout
+}
+
+// DownloadError records the package a download failed for
+type DownloadError struct {
+	Package string
+	URL     string
+	Err     error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("error downloading package %s from %s: %s", e.Package, e.URL, e.Err)
+}
+
+// Unwrap provides the underlying error, such as ErrNotFound
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// partialPath is the file a download is written to until it is complete,
+// so an interrupted download is never mistaken for a complete one
+func partialPath(dest string) string {
+	return dest + ".part"
+}
+
+// downloadFile downloads a file from a repository to dest, returning the resulting size.
+// Transient errors are retried with backoff and any partial download left by a previous
+// attempt is resumed from where it stopped, if the transport supports it.
+// The file is only written to dest once the download is complete.
+func downloadFile(fs afero.Fs, r RepoURL, url string, dest string, noSecure bool) (int64, error) {
+	part := partialPath(dest)
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fetchToFile(fs, r, url, part, noSecure)
+		if err == nil || !isTemporary(err) || attempt == maxDownloadAttempts {
+			break
+		}
+		delay := downloadBackoff * time.Duration(1<<uint(attempt-1))
+		log.WithFields(log.Fields{
+			"url":     url,
+			"attempt": attempt,
+			"retry":   delay,
+			"error":   err,
+		}).Warn("download failed, retrying")
+		time.Sleep(delay)
+	}
+	if te, ok := err.(temporaryError); ok {
+		err = te.err
+	}
+	if err != nil {
+		return 0, err
+	}
+	fi, err := fs.Stat(part)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), fs.Rename(part, dest)
+}
+
+// fetchToFile makes a single attempt at downloading url to the file at path,
+// resuming from the end of the file if it already has content
+func fetchToFile(fs afero.Fs, r RepoURL, url string, path string, noSecure bool) error {
+	var offset int64
+	if fi, err := fs.Stat(path); err == nil {
+		offset = fi.Size()
+	}
+	res, err := fetch(TransportRequest{Repo: r, URL: url, NoSecure: noSecure, Offset: offset, Fs: fs})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	resume := offset > 0 && res.Offset == offset
+	if resume {
+		log.WithFields(log.Fields{
+			"url":    url,
+			"offset": offset,
+		}).Debug("resuming download")
+	}
+	if _, err := copyToFile(fs, path, res.Body, resume); err != nil {
+		// anything copied so far is kept to be resumed
+		return temporaryError{err}
+	}
+	return verifyServedFile(fs, url, path, res)
+}
+
+// verifyServedFile checks a downloaded file against the size and md5 sum reported by the
+// server, if any. A short file is kept to be resumed, while any other mismatch is removed
+func verifyServedFile(fs afero.Fs, url string, path string, res *TransportResponse) error {
+	if res.Size > 0 {
+		fi, err := fs.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.Size() < res.Size {
+			return temporaryError{fmt.Errorf("download of %s incomplete, got %d of %d bytes", url, fi.Size(), res.Size)}
+		}
+		if fi.Size() > res.Size {
+			fs.Remove(path)
+			return fmt.Errorf("download of %s larger than reported by the server, got %d of %d bytes", url, fi.Size(), res.Size)
+		}
+	}
+	if res.MD5sum == "" {
+		return nil
+	}
+	sum, err := FileMD5(fs, path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, res.MD5sum) {
+		fs.Remove(path)
+		return fmt.Errorf("MD5sum checksum mismatch for %s: server reported %s, got %s", url, res.MD5sum, sum)
+	}
+	return nil
+}
+
+// copyToFile writes the content of r to the file at path, appending when resume is set
+func copyToFile(fs afero.Fs, path string, r io.Reader, resume bool) (int64, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := fs.OpenFile(path, flag, 0666)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// temporaryError marks errors, such as dropped connections, that may not occur on retry
+type temporaryError struct {
+	err error
+}
+
+func (e temporaryError) Error() string {
+	return e.err.Error()
+}
+
+func (e temporaryError) Temporary() bool {
+	return true
+}
+
+func isTemporary(err error) bool {
+	te, ok := err.(interface{ Temporary() bool })
+	return ok && te.Temporary()
+}
+
+// isCertificateError reports whether the request failed during TLS certificate verification,
+// by either side, which retrying will not fix
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return true
+	}
+	// alerts sent by the server, such as for a missing client certificate
+	return strings.Contains(err.Error(), "remote error: tls:")
+}
@@ -0,0 +1,209 @@
+package cran
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadFile(t *testing.T) {
+	downloadBackoff = time.Millisecond
+	defer func() { downloadBackoff = time.Second }()
+	content := []byte(strings.Repeat("pkgr", 1024))
+	modTime := time.Now()
+
+	tests := []struct {
+		name string
+		// handler serves the nth request, starting at 0
+		handler  func(n int, w http.ResponseWriter, r *http.Request)
+		requests int
+		err      func(error) bool
+	}{
+		{
+			name: "success",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "pkg.tar.gz", modTime, bytes.NewReader(content))
+			},
+			requests: 1,
+		},
+		{
+			name: "retries server errors",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				if n < 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				http.ServeContent(w, r, "pkg.tar.gz", modTime, bytes.NewReader(content))
+			},
+			requests: 3,
+		},
+		{
+			name: "resumes interrupted download",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				if n == 0 {
+					// promise the full content, but drop the connection half way
+					w.Header().Set("Content-Length", "4096")
+					w.Write(content[:2048])
+					return
+				}
+				if r.Header.Get("Range") != "bytes=2048-" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				http.ServeContent(w, r, "pkg.tar.gz", modTime, bytes.NewReader(content))
+			},
+			requests: 2,
+		},
+		{
+			name: "checks the md5 sum reported by the server",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				sum := md5.Sum(content)
+				w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+				http.ServeContent(w, r, "pkg.tar.gz", modTime, bytes.NewReader(content))
+			},
+			requests: 1,
+		},
+		{
+			name: "md5 sum mismatches are not retried",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				sum := md5.Sum([]byte("other"))
+				w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+				http.ServeContent(w, r, "pkg.tar.gz", modTime, bytes.NewReader(content))
+			},
+			requests: 1,
+			err: func(err error) bool {
+				return err != nil && strings.Contains(err.Error(), "MD5sum checksum mismatch")
+			},
+		},
+		{
+			name: "gives up after repeated server errors",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			requests: maxDownloadAttempts,
+			err: func(err error) bool {
+				se, ok := err.(*HTTPStatusError)
+				return ok && se.StatusCode == http.StatusBadGateway
+			},
+		},
+		{
+			name: "client errors are not retried",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+			requests: 1,
+			err: func(err error) bool {
+				se, ok := err.(*HTTPStatusError)
+				return ok && se.StatusCode == http.StatusForbidden
+			},
+		},
+		{
+			name: "not found",
+			handler: func(n int, w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+			requests: 1,
+			err:      func(err error) bool { return errors.Is(err, ErrNotFound) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1) - 1
+				tt.handler(int(n), w, r)
+			}))
+			defer server.Close()
+			dir, err := ioutil.TempDir("", "pkgr-download")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			dest := filepath.Join(dir, "pkg.tar.gz")
+
+			size, err := downloadFile(afero.NewOsFs(), RepoURL{}, server.URL+"/pkg.tar.gz", dest, false)
+			assert.Equal(t, tt.requests, int(atomic.LoadInt32(&requests)))
+			if tt.err != nil {
+				assert.True(t, tt.err(err), "unexpected error: %v", err)
+				_, statErr := os.Stat(dest)
+				assert.True(t, os.IsNotExist(statErr), "failed download should not be written to destination")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), size)
+			b, err := ioutil.ReadFile(dest)
+			assert.NoError(t, err)
+			assert.Equal(t, content, b)
+			_, statErr := os.Stat(partialPath(dest))
+			assert.True(t, os.IsNotExist(statErr), "partial download should be removed once complete")
+		})
+	}
+}
+
+func TestDownloadPackageWithPath(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTarball(t, filepath.Join(dir, "src", "contrib", "4.1.0", "Recommended"), "pkgA", "1.5.0", "")
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	d := PkgDl{
+		Package: desc.Desc{Package: "pkgA", Version: "1.5.0", Path: "4.1.0/Recommended"},
+		Config:  PkgConfig{Repo: RepoURL{Name: "CRAN", URL: server.URL}, Type: Source},
+	}
+	require.NoError(t, fs.MkdirAll("/cache/src", 0755))
+	dl, err := DownloadPackage(fs, d, "/cache/src/pkgA_1.5.0.tar.gz", RVersion{Major: 4, Minor: 1, Patch: 2}, Platform{}, false, true, false)
+	require.NoError(t, err)
+	assert.True(t, dl.New)
+	assert.Equal(t, "/cache/src/pkgA_1.5.0.tar.gz", dl.Path)
+}
+
+func TestDownloadPackageFromLocalRepoOnFs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	content := []byte("pkgA tarball")
+	require.NoError(t, afero.WriteFile(fs, "/repos/local/src/contrib/pkgA_1.0.0.tar.gz", content, 0644))
+	require.NoError(t, afero.WriteFile(fs, "/repos/local/src/contrib/Archive/pkgA/pkgA_0.9.0.tar.gz", content, 0644))
+	repo := RepoURL{Name: "local", URL: "file:///repos/local"}
+	d := PkgDl{
+		Package: desc.Desc{Package: "pkgA", Version: "1.0.0"},
+		Config:  PkgConfig{Repo: repo, Type: Source},
+	}
+	dl, err := DownloadPackage(fs, d, "/cache/src/pkgA_1.0.0.tar.gz", RVersion{}, Platform{}, false, true, false)
+	require.NoError(t, err)
+	assert.True(t, dl.New)
+	actual, err := afero.ReadFile(fs, dl.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+
+	files, err := fileTransport{}.List(TransportRequest{Repo: repo, URL: "file:///repos/local/src/contrib/Archive/pkgA", Fs: fs})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pkgA_0.9.0.tar.gz"}, files)
+}
+
+func TestSourceTypeString(t *testing.T) {
+	tests := []struct {
+		in       SourceType
+		expected string
+	}{
+		{Default, "default"},
+		{Source, "source"},
+		{Binary, "binary"},
+		{Both, "both"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.in.String())
+	}
+}
@@ -0,0 +1,31 @@
+package cran
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// openRepoFile opens a file from a repository through the transport for its url.
+// ErrNotFound is returned if the file is not present.
+func openRepoFile(r RepoURL, url string, noSecure bool) (io.ReadCloser, error) {
+	res, err := fetch(TransportRequest{Repo: r, URL: url, NoSecure: noSecure})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// listRepoDir lists the file names within a directory of a repository,
+// for repos whose transport is able to list directories
+func listRepoDir(r RepoURL, url string, noSecure bool) ([]string, error) {
+	t, err := transportFor(url)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := t.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("listing directories is not supported for %s:// urls", urlScheme(url))
+	}
+	return l.List(TransportRequest{Repo: r, URL: strings.TrimSuffix(url, "/"), NoSecure: noSecure})
+}
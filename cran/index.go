@@ -0,0 +1,114 @@
+package cran
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// packagesIndexFiles are the variants of the PACKAGES index tried for a repo, in order.
+// The compressed index is preferred as it is far smaller, however some repos only publish one or the other.
+var packagesIndexFiles = []string{"PACKAGES.gz", "PACKAGES"}
+
+// packagesIndex is the result of fetching the PACKAGES index for a source type of a repo
+type packagesIndex struct {
+	// Body streams the index, decompressed as it is read, and must be closed.
+	// It is unset when NotModified.
+	Body io.ReadCloser
+	// URL is the index variant used
+	URL         string
+	Validators  indexValidators
+	NotModified bool
+}
+
+// packagesIndexURLs provides the urls of the index variants to try, with the variant
+// used last time first, so an unchanged repo is revalidated with a single request
+func packagesIndexURLs(dirURL string, previous string) []string {
+	var urls []string
+	if previous != "" && strings.HasPrefix(previous, dirURL+"/") {
+		urls = append(urls, previous)
+	}
+	for _, f := range packagesIndexFiles {
+		u := dirURL + "/" + f
+		if u != previous {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// fetchPackagesIndex fetches the PACKAGES index within the directory of a repo, decompressing it if needed.
+// If revalidate is set, the request for the previously used variant is made conditional on the cached
+// validators, with NotModified set when the cached information is still current.
+func fetchPackagesIndex(r RepoURL, dirURL string, noSecure bool, cached indexValidators, revalidate bool) (packagesIndex, error) {
+	for _, u := range packagesIndexURLs(dirURL, cached.URL) {
+		index, err := fetchIndexFile(r, u, noSecure, cached, revalidate && cached.URL == u)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return index, err
+	}
+	return packagesIndex{}, fmt.Errorf("no package index found at %s, tried %s", dirURL, strings.Join(packagesIndexFiles, ", "))
+}
+
+func fetchIndexFile(r RepoURL, u string, noSecure bool, cached indexValidators, revalidate bool) (packagesIndex, error) {
+	index := packagesIndex{URL: u}
+	req := TransportRequest{Repo: r, URL: u, NoSecure: noSecure}
+	if revalidate {
+		cached.apply(&req)
+	}
+	res, err := fetch(req)
+	if errors.Is(err, ErrNotFound) {
+		return index, err
+	}
+	if err != nil {
+		return index, fmt.Errorf("problem getting packages from url %s: %s", u, err)
+	}
+	if res.NotModified {
+		index.Validators = cached
+		index.NotModified = true
+		return index, nil
+	}
+	index.Validators = newIndexValidators(u, res)
+	index.Body, err = readIndex(res.Body)
+	if err != nil {
+		res.Body.Close()
+		return index, fmt.Errorf("error reading body: %s", err)
+	}
+	return index, nil
+}
+
+// readIndex provides the content of an index, decompressing it as it is read if gzipped. The content
+// is checked rather than the file name, as servers may already have decoded the compressed index.
+// Closing the index closes r.
+func readIndex(r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return indexReader{Reader: gzr, closers: []io.Closer{gzr, r}}, nil
+	}
+	return indexReader{Reader: br, closers: []io.Closer{r}}, nil
+}
+
+// indexReader reads an index, closing each of the underlying readers when closed
+type indexReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r indexReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
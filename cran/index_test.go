@@ -0,0 +1,125 @@
+package cran
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPackagesIndex = "Package: pkgA\nVersion: 1.0.0\n\nPackage: pkgB\nVersion: 2.0.0\n"
+
+// newTestIndexDir creates a src/contrib directory containing the given index files
+func newTestIndexDir(t *testing.T, files ...string) string {
+	dir := t.TempDir()
+	contrib := filepath.Join(dir, "src", "contrib")
+	require.NoError(t, os.MkdirAll(contrib, 0755))
+	for _, f := range files {
+		content := []byte(testPackagesIndex)
+		if filepath.Ext(f) == ".gz" {
+			var buf bytes.Buffer
+			gzw := gzip.NewWriter(&buf)
+			_, err := gzw.Write(content)
+			require.NoError(t, err)
+			require.NoError(t, gzw.Close())
+			content = buf.Bytes()
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(contrib, f), content, 0644))
+	}
+	return dir
+}
+
+// readTestIndex reads the content of a fetched index, closing it
+func readTestIndex(t *testing.T, index packagesIndex) string {
+	require.NotNil(t, index.Body)
+	defer index.Body.Close()
+	b, err := ioutil.ReadAll(index.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestFetchPackagesIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		used  string
+	}{
+		{"compressed only", []string{"PACKAGES.gz"}, "PACKAGES.gz"},
+		{"uncompressed only", []string{"PACKAGES"}, "PACKAGES"},
+		{"prefers compressed", []string{"PACKAGES", "PACKAGES.gz"}, "PACKAGES.gz"},
+	}
+	for _, tt := range tests {
+		dir := newTestIndexDir(t, tt.files...)
+		server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+		for _, url := range []string{dir, "file://" + dir, server.URL} {
+			t.Run(tt.name+" "+url, func(t *testing.T) {
+				r := RepoURL{Name: "test", URL: url}
+				index, err := fetchPackagesIndex(r, url+"/src/contrib", false, indexValidators{}, false)
+				assert.NoError(t, err)
+				assert.Equal(t, url+"/src/contrib/"+tt.used, index.URL)
+				assert.Equal(t, testPackagesIndex, readTestIndex(t, index))
+			})
+		}
+		server.Close()
+	}
+
+	dir := newTestIndexDir(t)
+	_, err := fetchPackagesIndex(RepoURL{Name: "test", URL: dir}, dir+"/src/contrib", false, indexValidators{}, false)
+	assert.EqualError(t, err, "no package index found at "+dir+"/src/contrib, tried PACKAGES.gz, PACKAGES")
+}
+
+func TestPackagesIndexURLs(t *testing.T) {
+	dir := "https://cran.r-project.org/src/contrib"
+	assert.Equal(t, []string{dir + "/PACKAGES.gz", dir + "/PACKAGES"}, packagesIndexURLs(dir, ""))
+	assert.Equal(t, []string{dir + "/PACKAGES", dir + "/PACKAGES.gz"}, packagesIndexURLs(dir, dir+"/PACKAGES"))
+	// a variant recorded for a different directory, eg a previous R version, is ignored
+	assert.Equal(t, []string{dir + "/PACKAGES.gz", dir + "/PACKAGES"}, packagesIndexURLs(dir, "https://cran.r-project.org/bin/PACKAGES"))
+}
+
+// closeTracker records whether the reader it wraps has been closed
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReadIndex(t *testing.T) {
+	var compressed bytes.Buffer
+	gzw := gzip.NewWriter(&compressed)
+	_, err := gzw.Write([]byte(testPackagesIndex))
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"compressed", compressed.Bytes()},
+		{"uncompressed", []byte(testPackagesIndex)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &closeTracker{Reader: bytes.NewReader(tt.content)}
+			index, err := readIndex(body)
+			require.NoError(t, err)
+			b, err := ioutil.ReadAll(index)
+			assert.NoError(t, err)
+			assert.Equal(t, testPackagesIndex, string(b))
+			assert.False(t, body.closed)
+			assert.NoError(t, index.Close())
+			assert.True(t, body.closed, "closing the index closes the response body")
+		})
+	}
+}
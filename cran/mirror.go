@@ -0,0 +1,83 @@
+package cran
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// mirrorURLs provides u, a url within the repo, on the repo url followed by each of
+// its mirrors in order. As the mirrors hold the same content, only the base of
+// the url differs.
+func (r RepoURL) mirrorURLs(u string) []string {
+	urls := []string{u}
+	base := strings.TrimSuffix(r.URL, "/")
+	if !strings.HasPrefix(u, base) {
+		return urls
+	}
+	for _, m := range r.Mirrors {
+		urls = append(urls, strings.TrimSuffix(m, "/")+strings.TrimPrefix(u, base))
+	}
+	return urls
+}
+
+// mirrorBase provides the repo url or mirror that u is located on
+func (r RepoURL) mirrorBase(u string) string {
+	for _, m := range r.Mirrors {
+		if strings.HasPrefix(u, strings.TrimSuffix(m, "/")+"/") {
+			return m
+		}
+	}
+	return r.URL
+}
+
+// fetchMirroredIndex fetches the PACKAGES index within the directory of a repo,
+// failing over to each mirror of the repo in turn
+func fetchMirroredIndex(r RepoURL, dirURL string, noSecure bool, cached indexValidators, revalidate bool) (packagesIndex, error) {
+	var index packagesIndex
+	var err error
+	urls := r.mirrorURLs(dirURL)
+	for i, u := range urls {
+		index, err = fetchPackagesIndex(r, u, noSecure, cached, revalidate)
+		if err == nil {
+			if i > 0 {
+				log.WithFields(log.Fields{
+					"repo":   r.Name,
+					"mirror": r.Mirrors[i-1],
+				}).Info("packages database fetched from mirror")
+			}
+			return index, nil
+		}
+		if i < len(urls)-1 {
+			log.WithFields(log.Fields{
+				"repo":  r.Name,
+				"url":   u,
+				"error": err,
+			}).Warn("could not fetch packages database, trying next mirror")
+		}
+	}
+	return index, err
+}
+
+// downloadFromMirrors downloads a file from a repository to dest, failing over to each
+// mirror of the repo in turn, returning the resulting size and the url downloaded from
+func downloadFromMirrors(fs afero.Fs, r RepoURL, url string, dest string, noSecure bool) (int64, string, error) {
+	var size int64
+	var err error
+	urls := r.mirrorURLs(url)
+	for i, u := range urls {
+		size, err = downloadFile(fs, r, u, dest, noSecure)
+		if err == nil {
+			return size, u, nil
+		}
+		if i < len(urls)-1 {
+			log.WithFields(log.Fields{
+				"repo":  r.Name,
+				"url":   u,
+				"error": err,
+			}).Warn("download failed, trying next mirror")
+		}
+	}
+	return size, url, err
+}
@@ -0,0 +1,72 @@
+package cran
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorURLs(t *testing.T) {
+	r := RepoURL{Name: "CRAN", URL: "https://cran.rstudio.com/", Mirrors: []string{"https://cloud.r-project.org", "https://cran.r-project.org/"}}
+	assert.Equal(t, []string{
+		"https://cran.rstudio.com/src/contrib/PACKAGES",
+		"https://cloud.r-project.org/src/contrib/PACKAGES",
+		"https://cran.r-project.org/src/contrib/PACKAGES",
+	}, r.mirrorURLs("https://cran.rstudio.com/src/contrib/PACKAGES"))
+	assert.Equal(t, []string{"https://other.com/pkg.tar.gz"}, r.mirrorURLs("https://other.com/pkg.tar.gz"))
+	assert.Equal(t, "https://cran.r-project.org/", r.mirrorBase("https://cran.r-project.org/src/contrib/pkgA_1.0.0.tar.gz"))
+	assert.Equal(t, "https://cran.rstudio.com/", r.mirrorBase("https://cran.rstudio.com/src/contrib/pkgA_1.0.0.tar.gz"))
+}
+
+func TestMirrorFailover(t *testing.T) {
+	os.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	downloadBackoff = time.Millisecond
+	defer func() { downloadBackoff = time.Second }()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	dir := newTestIndexDir(t, "PACKAGES")
+	writeTestTarball(t, filepath.Join(dir, "src", "contrib"), "pkgA", "1.0.0", "")
+	mirror := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer mirror.Close()
+
+	rv := RVersion{Major: 4, Minor: 1, Patch: 2}
+	repo := RepoURL{Name: "CRAN", URL: down.URL, Mirrors: []string{down.URL + "/unreachable", mirror.URL}}
+	db := &RepoDb{
+		DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+		Repo:                     repo,
+		DefaultSourceType:        Source,
+	}
+	require.NoError(t, db.FetchPackages(rv, false))
+	assert.Len(t, db.DescriptionsBySourceType[Source]["pkgA"], 1)
+
+	// the cache is keyed by the repo url regardless of the mirror used
+	primary := &RepoDb{
+		DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+		Repo:                     RepoURL{Name: "CRAN", URL: down.URL},
+	}
+	assert.Equal(t, primary.GetRepoDbCacheFilePath(rv.ToFullString()), db.GetRepoDbCacheFilePath(rv.ToFullString()))
+	assert.Equal(t, RepoURLHash(primary.Repo), RepoURLHash(repo))
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, fs.MkdirAll("/cache/src", 0755))
+	d := PkgDl{
+		Package: desc.Desc{Package: "pkgA", Version: "1.0.0"},
+		Config:  PkgConfig{Repo: repo, Type: Source},
+	}
+	dl, err := DownloadPackage(fs, d, "/cache/src/pkgA_1.0.0.tar.gz", rv, Platform{}, false, true, false)
+	require.NoError(t, err)
+	assert.True(t, dl.New)
+	assert.Equal(t, mirror.URL, dl.Mirror)
+}
@@ -0,0 +1,68 @@
+package cran
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchPackagesOffline(t *testing.T) {
+	os.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	rv := RVersion{Major: 4, Minor: 1, Patch: 2}
+	newDb := func() *RepoDb {
+		return &RepoDb{
+			DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+			Repo:                     RepoURL{Name: "airgapped", URL: "https://repo.invalid"},
+			offline:                  true,
+		}
+	}
+
+	err := newDb().FetchPackages(rv, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "offline and no cached repo information for airgapped (https://repo.invalid) with R 4.1.2")
+	}
+
+	// a stale cache is used as is, rather than refreshed
+	cached := newDb()
+	cached.DescriptionsBySourceType[Source]["pkgA"] = []desc.Desc{{Package: "pkgA", Version: "1.0.0"}}
+	cacheFile := cached.GetRepoDbCacheFilePath(rv.ToFullString())
+	require.NoError(t, cached.Encode(cacheFile, rv))
+	stale := time.Now().Add(-30 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(cacheFile, stale, stale))
+
+	db := newDb()
+	assert.NoError(t, db.FetchPackages(rv, false))
+	assert.Equal(t, "1.0.0", db.DescriptionsBySourceType[Source]["pkgA"][0].Version)
+}
+
+func TestDownloadPackagesOffline(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	baseDir := "/cache"
+	repo := RepoURL{Name: "CRAN", URL: "https://repo.invalid"}
+	ds := []PkgDl{
+		{Package: desc.Desc{Package: "pkgA", Version: "1.0.0"}, Config: PkgConfig{Repo: repo, Type: Source}},
+		{Package: desc.Desc{Package: "pkgB", Version: "2.0.0"}, Config: PkgConfig{Repo: repo, Type: Source}},
+		{Package: desc.Desc{Package: "pkgC", Version: "0.1.0"}, Config: PkgConfig{Repo: repo, Type: Source}},
+	}
+	require.NoError(t, afero.WriteFile(fs, packageCachePath(ds[0], baseDir, RVersion{}, Platform{}), []byte("pkgA"), 0644))
+
+	_, err := DownloadPackages(fs, ds, baseDir, RVersion{}, Platform{}, false, false, true)
+	assert.EqualError(t, err, "offline and 2 package(s) missing from the package cache: pkgB_2.0.0 (CRAN, source), pkgC_0.1.0 (CRAN, source)")
+
+	for _, d := range ds[1:] {
+		require.NoError(t, afero.WriteFile(fs, packageCachePath(d, baseDir, RVersion{}, Platform{}), []byte(d.Package.Package), 0644))
+	}
+	pkgMap, err := DownloadPackages(fs, ds, baseDir, RVersion{}, Platform{}, false, false, true)
+	assert.NoError(t, err)
+	for _, d := range ds {
+		dl, ok := pkgMap.Get(d.Package.Package)
+		assert.True(t, ok)
+		assert.False(t, dl.New)
+	}
+}
@@ -14,10 +14,16 @@ import (
 // noSecure will allow https fetching without validating the certificate chain.
 // This occasionally is needed for repos that have self signed or certs not fully verifiable
 // which will return errors such as x509: certificate signed by unknown authority
+// Repos are queried for the binaries of cfgdb.Platform, or the local platform when unset.
 func NewPkgDb(urls []RepoURL, dst SourceType, cfgdb *InstallConfig, rv RVersion, noSecure bool) (*PkgNexus, error) {
+	p := cfgdb.Platform.orLocal()
 	pkgNexus := PkgNexus{
 		Config:            cfgdb,
 		DefaultSourceType: dst,
+		Constraints:       make(PkgConstraints),
+		RVersion:          rv,
+		Platform:          p,
+		NoSecure:          noSecure,
 	}
 	if len(urls) == 0 {
 		return &pkgNexus, errors.New("Package database must contain at least one RepoUrl")
@@ -34,7 +40,11 @@ func NewPkgDb(urls []RepoURL, dst SourceType, cfgdb *InstallConfig, rv RVersion,
 	for _, url := range urls {
 		pkgNexus.Db = append(pkgNexus.Db, nil)
 		go func(url RepoURL, dst SourceType, ri int) {
-			rdb, err := NewRepoDb(url, dst, cfgdb.Repos[url.Name], rv, noSecure)
+			rc := cfgdb.Repos[url.Name]
+			if cfgdb.Offline {
+				rc.Offline = true
+			}
+			rdb, err := NewRepoDb(url, dst, rc, rv, p, noSecure)
 			rdbc <- rd{url, rdb, ri, err}
 		}(url, dst, ri)
 		ri++
@@ -51,7 +61,7 @@ func NewPkgDb(urls []RepoURL, dst SourceType, cfgdb *InstallConfig, rv RVersion,
 			log.WithFields(log.Fields{
 				"repo":  result.Url.Name,
 				"url":   result.Url.URL,
-				"error": err,
+				"error": result.Err,
 			}).Error("error downloading repo information")
 			err = result.Err
 		} else {
@@ -72,10 +82,20 @@ func (pkgNexus *PkgNexus) SetPackageRepo(pkg string, repo string) error {
 			return nil
 		}
 	}
+	// a repo expanded into multiple repos, eg Bioconductor, allows
+	// the package to come from any of them
+	for _, r := range pkgNexus.Db {
+		if r.Repo.Group == repo {
+			cfg := pkgNexus.Config.Packages[pkg]
+			cfg.Repo = RepoURL{Name: repo}
+			pkgNexus.Config.Packages[pkg] = cfg
+			return nil
+		}
+	}
 	return fmt.Errorf("no repo: %s, detected containing package: %s", repo, pkg)
 }
 
-// SetPackageType sets the package type (source/binary) for installation
+// SetPackageType sets the package type (source/binary/both) for installation
 func (pkgNexus *PkgNexus) SetPackageType(pkg string, t string) error {
 	cfg := pkgNexus.Config.Packages[pkg]
 	err := setType(&cfg, t)
@@ -91,17 +111,19 @@ func setType(cfg *PkgConfig, t string) error {
 		cfg.Type = Source
 	} else if strings.EqualFold(t, "binary") {
 		cfg.Type = Binary
+	} else if strings.EqualFold(t, "both") {
+		cfg.Type = Both
 	} else {
 		return fmt.Errorf("invalid source type: %s", t)
 	}
 	return nil
 }
 
-func pkgExists(pkg string, db map[string]desc.Desc) bool {
+func pkgExists(pkg string, db map[string][]desc.Desc) bool {
 	_, exists := db[pkg]
 	return exists
 }
-func pkgExistsInRepo(pkg string, dbs map[SourceType]map[string]desc.Desc) bool {
+func pkgExistsInRepo(pkg string, dbs map[SourceType]map[string][]desc.Desc) bool {
 	exists := false
 	for _, db := range dbs {
 		_, exists = db[pkg]
@@ -115,7 +137,7 @@ func pkgExistsInRepo(pkg string, dbs map[SourceType]map[string]desc.Desc) bool {
 func isCorrectRepo(pkg string, r RepoURL, cfg map[string]PkgConfig) bool {
 	pkgcfg, exists := cfg[pkg]
 	if exists && pkgcfg.Repo.Name != "" {
-		if pkgcfg.Repo.Name == r.Name {
+		if pkgcfg.Repo.Name == r.Name || pkgcfg.Repo.Name == r.Group {
 			return true
 		} else {
 			return false
@@ -140,22 +162,135 @@ func (pkgNexus *PkgNexus) GetPackage(pkg string) (desc.Desc, PkgConfig, bool) {
 		// in the config. Eg, if specifies binary, will only check binary version
 		// the checking if also exists as source or otherwise should occur upstream
 		// then be set as part of the explicit configuration.
-		if pkgExists(pkg, db.DescriptionsBySourceType[rst]) && isCorrectRepo(pkg, db.Repo, pkgNexus.Config.Packages) {
-			return db.DescriptionsBySourceType[rst][pkg], PkgConfig{Repo: db.Repo, Type: rst}, true
+		// Any version constraints on the package must also be met, otherwise
+		// continue on to the next repo that may provide a satisfying version
+		// The highest version compatible with the R version is used when the repo
+		// lists more than one
+		if !isCorrectRepo(pkg, db.Repo, pkgNexus.Config.Packages) {
+			continue
+		}
+		// the Include and Exclude patterns of a repo keep it from shadowing
+		// packages that must come from elsewhere
+		if !pkgNexus.repoAllows(db.Repo, pkg) {
+			if pkgExistsInRepo(pkg, db.DescriptionsBySourceType) {
+				log.WithFields(log.Fields{
+					"pkg":  pkg,
+					"repo": db.Repo.Name,
+				}).Debug("package excluded from repo by its Include/Exclude patterns")
+			}
+			continue
+		}
+		if rst == Both {
+			if d, st, reason, ok := pkgNexus.selectBothVersion(db, pkg); ok {
+				return d, PkgConfig{Repo: db.Repo, Type: st, Reason: reason}, true
+			}
+			continue
+		}
+		if d, ok := pkgNexus.selectVersion(db.DescriptionsBySourceType[rst][pkg]); ok {
+			return d, PkgConfig{Repo: db.Repo, Type: rst}, true
+		}
+	}
+	// archived versions are only considered once no current version fits,
+	// and can only be installed from source
+	for _, db := range pkgNexus.Db {
+		if !isCorrectRepo(pkg, db.Repo, pkgNexus.Config.Packages) || !pkgNexus.repoAllows(db.Repo, pkg) {
+			continue
+		}
+		if d, ok := pkgNexus.selectVersion(db.ArchivedDescriptions[pkg]); ok {
+			return d, PkgConfig{Repo: db.Repo, Type: Source}, true
 		}
 	}
 	return desc.Desc{}, PkgConfig{}, false
 }
 
-// GetPackageFromRepo gets a package from a repo in the package database
+// AddConstraint registers a version constraint any version of the
+// package returned from the package database must satisfy
+func (pkgNexus *PkgNexus) AddConstraint(dep desc.Dep, requiredBy string) {
+	if pkgNexus.Constraints == nil {
+		pkgNexus.Constraints = make(PkgConstraints)
+	}
+	pkgNexus.Constraints.Add(dep, requiredBy)
+}
+
+// CheckConstraints returns a ConstraintError if the package is present in the
+// package database, but no version of it satisfies the registered constraints.
+// Packages not present at all are left to be reported as missing packages.
+func (pkgNexus *PkgNexus) CheckConstraints(pkg string) error {
+	if _, _, ok := pkgNexus.GetPackage(pkg); ok {
+		return nil
+	}
+	available := pkgNexus.GetAvailableVersions(pkg)
+	if len(available) == 0 {
+		return nil
+	}
+	return &ConstraintError{
+		Package:     pkg,
+		Constraints: pkgNexus.Constraints[pkg],
+		Available:   available,
+	}
+}
+
+// GetAvailableVersions describes every version of a package in the package database
+// in the form <version> (<repo>, <type>), in repo order and newest first. Archived versions are
+// only included once they have been resolved, and repos not permitted to provide the package are skipped.
+func (pkgNexus *PkgNexus) GetAvailableVersions(pkg string) []string {
+	var available []string
+	for _, db := range pkgNexus.Db {
+		available = append(available, pkgNexus.repoVersions(db, pkg)...)
+	}
+	return available
+}
+
+// GetVersionsByRepo describes every version of a package available from each repo
+// of the package database, newest first, keyed by repo name
+func (pkgNexus *PkgNexus) GetVersionsByRepo(pkg string) map[string][]string {
+	versions := make(map[string][]string)
+	for _, db := range pkgNexus.Db {
+		if available := pkgNexus.repoVersions(db, pkg); len(available) > 0 {
+			versions[db.Repo.Name] = available
+		}
+	}
+	return versions
+}
+
+func (pkgNexus *PkgNexus) repoVersions(db *RepoDb, pkg string) []string {
+	var available []string
+	if !pkgNexus.repoAllows(db.Repo, pkg) {
+		return available
+	}
+	for _, st := range []SourceType{Source, Binary} {
+		for _, d := range db.DescriptionsBySourceType[st][pkg] {
+			available = append(available, pkgNexus.describeVersion(d, db.Repo.Name, st.String()))
+		}
+	}
+	for _, d := range db.ArchivedDescriptions[pkg] {
+		available = append(available, pkgNexus.describeVersion(d, db.Repo.Name, "archive"))
+	}
+	return available
+}
+
+// GetPackageFromRepo gets a package from a repo in the package database, selecting
+// the version as GetPackage does for the R version, constraints and repo Include/Exclude patterns
 func (pkgNexus *PkgNexus) GetPackageFromRepo(pkg string, repo string) (desc.Desc, PkgConfig, bool) {
 	st := pkgNexus.Config.Packages[pkg].Type
+	if st == Default {
+		st = pkgNexus.DefaultSourceType
+	}
 	for _, db := range pkgNexus.Db {
 		if repo != "" && db.Repo.Name != repo {
 			continue
 		}
-		if pkgExists(pkg, db.DescriptionsBySourceType[st]) {
-			return db.DescriptionsBySourceType[st][pkg], PkgConfig{Repo: db.Repo, Type: st}, true
+		if !pkgNexus.repoAllows(db.Repo, pkg) {
+			continue
+		}
+		if st == Both {
+			if d, bst, reason, ok := pkgNexus.selectBothVersion(db, pkg); ok {
+				return d, PkgConfig{Repo: db.Repo, Type: bst, Reason: reason}, true
+			}
+			continue
+		}
+		if d, ok := pkgNexus.selectVersion(db.DescriptionsBySourceType[st][pkg]); ok {
+			return d, PkgConfig{Repo: db.Repo, Type: st}, true
 		}
 	}
 	return desc.Desc{}, PkgConfig{}, false
@@ -0,0 +1,125 @@
+package cran
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Platform is the system packages are planned for, which determines
+// the binary packages available from repos and how they are named
+type Platform struct {
+	// OS is the operating system as named by GOOS, eg linux, darwin or windows
+	OS string
+	// Arch and Vendor make up the R platform along with the OS, eg x86_64 and pc
+	// for x86_64-pc-linux-gnu
+	Arch   string
+	Vendor string
+	// Distro describes the linux distribution, if any
+	Distro OsRelease
+}
+
+// knownDistros are the os-release details of the linux distributions
+// that can be targeted by name
+var knownDistros = map[string]OsRelease{
+	"xenial":   {Id: "ubuntu", VersionId: "16.04", VersionCodename: "xenial"},
+	"bionic":   {Id: "ubuntu", VersionId: "18.04", VersionCodename: "bionic"},
+	"focal":    {Id: "ubuntu", VersionId: "20.04", VersionCodename: "focal"},
+	"jammy":    {Id: "ubuntu", VersionId: "22.04", VersionCodename: "jammy"},
+	"noble":    {Id: "ubuntu", VersionId: "24.04", VersionCodename: "noble"},
+	"buster":   {Id: "debian", VersionId: "10", VersionCodename: "buster"},
+	"bullseye": {Id: "debian", VersionId: "11", VersionCodename: "bullseye"},
+	"bookworm": {Id: "debian", VersionId: "12", VersionCodename: "bookworm"},
+	"centos7":  {Id: "centos", VersionId: "7"},
+	"centos8":  {Id: "centos", VersionId: "8"},
+	"rhel8":    {Id: "rhel", VersionId: "8"},
+	"rhel9":    {Id: "rhel", VersionId: "9"},
+}
+
+// LocalPlatform provides the platform pkgr is running on
+func LocalPlatform() Platform {
+	p := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH, Vendor: "pc"}
+	switch p.Arch {
+	case "amd64":
+		p.Arch = "x86_64"
+	case "arm64":
+		p.Arch = "aarch64"
+		p.Vendor = "unknown"
+	}
+	if p.OS != "linux" {
+		return p
+	}
+	if err := ReadOsRelease(); err != nil {
+		log.Warnf("error reading linux binary information: %s\n", err)
+		return p
+	}
+	p.Distro = osRelease
+	if p.Distro.Id == "rhel" {
+		p.Vendor = "redhat"
+	}
+	return p
+}
+
+// ParsePlatform parses an R platform, such as x86_64-pc-linux-gnu,
+// x86_64-apple-darwin17.0 or x86_64-w64-mingw32
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.SplitN(platform, "-", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %s, must be of the form <arch>-<vendor>-<os>, eg x86_64-pc-linux-gnu", platform)
+	}
+	p := Platform{Arch: parts[0], Vendor: parts[1]}
+	switch {
+	case strings.HasPrefix(parts[2], "linux"):
+		p.OS = "linux"
+	case strings.HasPrefix(parts[2], "darwin"):
+		p.OS = "darwin"
+	case strings.HasPrefix(parts[2], "mingw"):
+		p.OS = "windows"
+	default:
+		return Platform{}, fmt.Errorf("unsupported os %s in platform %s", parts[2], platform)
+	}
+	return p, nil
+}
+
+// ParseDistro provides the os-release details of a linux distribution given
+// its codename, eg jammy or bookworm, or as <id><major version>, eg centos7 or rhel9
+func ParseDistro(distro string) (OsRelease, error) {
+	d, ok := knownDistros[strings.ToLower(distro)]
+	if !ok {
+		var names []string
+		for n := range knownDistros {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return OsRelease{}, fmt.Errorf("unknown distro %s, must be one of %s", distro, strings.Join(names, ", "))
+	}
+	d.checked = true
+	return d, nil
+}
+
+// String provides the R platform, eg x86_64-pc-linux-gnu
+func (p Platform) String() string {
+	return fmt.Sprintf("%s-%s-%s", p.Arch, p.Vendor, p.osName())
+}
+
+// osName provides the os making up the R platform
+func (p Platform) osName() string {
+	switch p.OS {
+	case "linux":
+		return "linux-gnu"
+	case "windows":
+		return "mingw32"
+	}
+	return p.OS
+}
+
+// orLocal provides the platform, or the local platform when none is set
+func (p Platform) orLocal() Platform {
+	if p.OS == "" {
+		return LocalPlatform()
+	}
+	return p
+}
@@ -0,0 +1,134 @@
+package cran
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected Platform
+	}{
+		{"x86_64-pc-linux-gnu", Platform{OS: "linux", Arch: "x86_64", Vendor: "pc"}},
+		{"aarch64-unknown-linux-gnu", Platform{OS: "linux", Arch: "aarch64", Vendor: "unknown"}},
+		{"x86_64-apple-darwin17.0", Platform{OS: "darwin", Arch: "x86_64", Vendor: "apple"}},
+		{"x86_64-w64-mingw32", Platform{OS: "windows", Arch: "x86_64", Vendor: "w64"}},
+	}
+	for _, tt := range tests {
+		p, err := ParsePlatform(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.expected, p, tt.in)
+	}
+	for _, in := range []string{"", "x86_64", "x86_64-pc-solaris", "-pc-linux-gnu"} {
+		_, err := ParsePlatform(in)
+		assert.Error(t, err, in)
+	}
+	assert.Equal(t, "x86_64-pc-linux-gnu", Platform{OS: "linux", Arch: "x86_64", Vendor: "pc"}.String())
+	assert.Equal(t, "x86_64-w64-mingw32", Platform{OS: "windows", Arch: "x86_64", Vendor: "w64"}.String())
+}
+
+func TestParseDistro(t *testing.T) {
+	d, err := ParseDistro("jammy")
+	require.NoError(t, err)
+	assert.Equal(t, "ubuntu", d.Id)
+	assert.Equal(t, "22.04", d.VersionId)
+	d, err = ParseDistro("RHEL9")
+	require.NoError(t, err)
+	assert.Equal(t, "rhel", d.Id)
+	_, err = ParseDistro("plan9")
+	assert.Error(t, err)
+}
+
+func TestParseRVersion(t *testing.T) {
+	rv, err := ParseRVersion("4.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, RVersion{Major: 4, Minor: 2, Patch: 1}, rv)
+	rv, err = ParseRVersion("4.3")
+	require.NoError(t, err)
+	assert.Equal(t, RVersion{Major: 4, Minor: 3}, rv)
+	for _, in := range []string{"", "4", "4.x.1", "4.2.1.1"} {
+		_, err := ParseRVersion(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestPlatformBinaries(t *testing.T) {
+	jammy, _ := ParseDistro("jammy")
+	rhel9, _ := ParseDistro("rhel9")
+	rv := RVersion{Major: 4, Minor: 2, Patch: 1}
+	tests := []struct {
+		name        string
+		platform    Platform
+		binaryName  string
+		binaryURL   string
+		defaultType SourceType
+		rspm        bool
+	}{
+		{
+			"jammy",
+			Platform{OS: "linux", Arch: "x86_64", Vendor: "pc", Distro: jammy},
+			"R6_2.5.1_R_x86_64-pc-linux-gnu.tar.gz",
+			"linux/ubuntu/jammy",
+			Source,
+			true,
+		},
+		{
+			"rhel9",
+			Platform{OS: "linux", Arch: "x86_64", Vendor: "redhat", Distro: rhel9},
+			"R6_2.5.1_R_x86_64-redhat-linux-gnu.tar.gz",
+			"linux/centos/9",
+			Source,
+			true,
+		},
+		{
+			"linux without distro",
+			Platform{OS: "linux", Arch: "x86_64", Vendor: "pc"},
+			"R6_2.5.1_R_x86_64-pc-linux-gnu.tar.gz",
+			"linux/",
+			Source,
+			false,
+		},
+		{
+			"darwin",
+			Platform{OS: "darwin", Arch: "x86_64", Vendor: "apple"},
+			"R6_2.5.1.tgz",
+			"macosx",
+			Binary,
+			true,
+		},
+		{
+			"windows",
+			Platform{OS: "windows", Arch: "x86_64", Vendor: "w64"},
+			"R6_2.5.1.zip",
+			"windows",
+			Binary,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.binaryName, binaryName("R6", "2.5.1", tt.platform))
+			assert.Equal(t, tt.binaryURL, cranBinaryURL(rv, tt.platform))
+			assert.Equal(t, tt.defaultType, DefaultType(tt.platform))
+			assert.Equal(t, tt.rspm, SupportsBinary(RSPM, tt.platform))
+			assert.Equal(t, tt.platform.OS != "linux", SupportsBinary(CRAN, tt.platform))
+		})
+	}
+}
+
+func TestPackagesFileURLForPlatform(t *testing.T) {
+	jammy, _ := ParseDistro("jammy")
+	db := &RepoDb{
+		Repo:     RepoURL{Name: "MPN", URL: "https://mpn.metworx.com/snapshots/stable/2022-06-15/"},
+		Platform: Platform{OS: "linux", Arch: "x86_64", Vendor: "pc", Distro: jammy},
+	}
+	rv := RVersion{Major: 4, Minor: 2, Patch: 1}
+	assert.Equal(t, "https://mpn.metworx.com/snapshots/stable/2022-06-15/bin/linux/ubuntu/jammy/contrib/4.2/PACKAGES",
+		GetPackagesFileURL(db, Binary, rv))
+	db.Platform = Platform{OS: "windows", Arch: "x86_64", Vendor: "w64"}
+	assert.Equal(t, "https://mpn.metworx.com/snapshots/stable/2022-06-15/bin/windows/contrib/4.2/PACKAGES",
+		GetPackagesFileURL(db, Binary, rv))
+}
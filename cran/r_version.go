@@ -1,6 +1,10 @@
 package cran
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // ToFullString provides a string representation of the Rversion
 func (rv RVersion) ToFullString() string {
@@ -11,3 +15,20 @@ func (rv RVersion) ToFullString() string {
 func (rv RVersion) ToString() string {
 	return fmt.Sprintf("%v.%v", rv.Major, rv.Minor)
 }
+
+// ParseRVersion parses an R version such as 4.2.1, the patch version being optional
+func ParseRVersion(s string) (RVersion, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return RVersion{}, fmt.Errorf("invalid R version %s, must be of the form <major>.<minor>.<patch>, eg 4.2.1", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return RVersion{}, fmt.Errorf("invalid R version %s, must be of the form <major>.<minor>.<patch>, eg 4.2.1", s)
+		}
+		v[i] = n
+	}
+	return RVersion{Major: v[0], Minor: v[1], Patch: v[2]}, nil
+}
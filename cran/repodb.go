@@ -1,35 +1,45 @@
 package cran
 
 import (
-	"bytes"
 	"crypto/md5"
-	"crypto/tls"
 	"encoding/gob"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/metrumresearchgroup/pkgr/desc"
-	homedir "github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 )
 
 // NewRepoDb returns a new Repo database
-// noSecure will allow https fetching without validating the certificate chain.
-// This occasionally is needed for repos that have self signed or certs not fully verifiable
-// which will return errors such as x509: certificate signed by unknown authority
-func NewRepoDb(url RepoURL, dst SourceType, rc RepoConfig, rv RVersion, noSecure bool) (*RepoDb, error) {
+// noSecure skips validating the certificate chain, see NewPkgDb.
+// Binaries are those for the R version rv on platform p.
+func NewRepoDb(url RepoURL, dst SourceType, rc RepoConfig, rv RVersion, p Platform, noSecure bool) (*RepoDb, error) {
+	if rc.RepoType == RSPM && p.OS == "linux" {
+		if linuxRepo, ok := rspmLinuxRepo(url, rv, p); ok {
+			url = linuxRepo
+			if rc.DefaultSourceType == Default {
+				rc.DefaultSourceType = Binary
+			}
+			log.WithFields(log.Fields{
+				"repo":       url.Name,
+				"binary_url": url.BinaryURL,
+				"user_agent": url.UserAgent,
+			}).Debug("using Posit Package Manager linux binaries")
+		}
+	}
 	repoDatabasePointer := &RepoDb{
-		DescriptionsBySourceType: make(map[SourceType]map[string]desc.Desc),
+		DescriptionsBySourceType: make(map[SourceType]map[string][]desc.Desc),
 		Time:                     time.Now(),
 		Repo:                     url,
+		Platform:                 p,
+		offline:                  rc.Offline,
 	}
 	if rc.DefaultSourceType == Default {
 		repoDatabasePointer.DefaultSourceType = dst
@@ -37,8 +47,8 @@ func NewRepoDb(url RepoURL, dst SourceType, rc RepoConfig, rv RVersion, noSecure
 		repoDatabasePointer.DefaultSourceType = rc.DefaultSourceType
 	}
 
-	if SupportsBinary(rc.RepoType) {
-		repoDatabasePointer.DescriptionsBySourceType[Binary] = make(map[string]desc.Desc)
+	if SupportsBinary(rc.RepoType, p) {
+		repoDatabasePointer.DescriptionsBySourceType[Binary] = make(map[string][]desc.Desc)
 	}
 
 	if rc.RepoSuffix != "" {
@@ -46,12 +56,13 @@ func NewRepoDb(url RepoURL, dst SourceType, rc RepoConfig, rv RVersion, noSecure
 		url.Suffix = rc.RepoSuffix
 	}
 
-	repoDatabasePointer.DescriptionsBySourceType[Source] = make(map[string]desc.Desc)
+	repoDatabasePointer.DescriptionsBySourceType[Source] = make(map[string][]desc.Desc)
 
 	return repoDatabasePointer, repoDatabasePointer.FetchPackages(rv, noSecure)
 }
 
-// Decode decodes the package database
+// Decode decodes the package database, returning an error for caches that are
+// corrupt, belong to another repo or were written by an incompatible version of pkgr
 func (repoDb *RepoDb) Decode(file string) error {
 	f, err := os.Open(file)
 	if err != nil {
@@ -60,66 +71,111 @@ func (repoDb *RepoDb) Decode(file string) error {
 	}
 	defer f.Close()
 	d := gob.NewDecoder(f)
-	return d.Decode(&repoDb.DescriptionsBySourceType)
+	header, err := decodeRepoDbCacheHeader(d)
+	if err != nil {
+		return err
+	}
+	if repoDb.Repo.URL != "" && header.URL != repoDb.Repo.URL {
+		return fmt.Errorf("cache is for %s rather than %s", header.URL, repoDb.Repo.URL)
+	}
+	descriptions := make(map[SourceType]map[string][]desc.Desc)
+	if err := d.Decode(&descriptions); err != nil {
+		return fmt.Errorf("unreadable cached packages: %s", err)
+	}
+	repoDb.DescriptionsBySourceType = descriptions
+	repoDb.Time = header.Fetched
+	return nil
 }
 
-// Encode encodes the PackageDatabase
-func (repoDb *RepoDb) Encode(file string) error {
+// Encode encodes the PackageDatabase, preceded by a header describing it.
+// The file is only replaced once fully written, so is never left partially written.
+func (repoDb *RepoDb) Encode(file string, rVersion RVersion) error {
 	err := os.MkdirAll(filepath.Dir(file), 0777)
 	if err != nil {
 		return err
 	}
-	f, err := os.Create(file)
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
 	e := gob.NewEncoder(f)
-
-	// Encoding the map
-	err = e.Encode(repoDb.DescriptionsBySourceType)
+	err = e.Encode(repoDb.newRepoDbCacheHeader(rVersion))
+	if err == nil {
+		// Encoding the map
+		err = e.Encode(repoDb.DescriptionsBySourceType)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	return nil
+	return os.Rename(tmp, file)
 }
 
 // Hash provides a hash based on the RepoDb sources
 func (repoDb *RepoDb) Hash(rVersion string) string {
 	h := md5.New()
-	// want to get the unique elements in the DescriptionsBySourceType so the cache
-	// will be representative of the config. Eg if set to only source
-	// vs Source/Binary
-	stsum := Source
+	// the cache is named by the set of source types the repo was indexed for, so that
+	// a source only config does not share the cache of a source and binary one. The sorted
+	// names are hashed, rather than any combination of the type values, so the names
+	// stay stable as types are added
+	var types []string
 	for st := range repoDb.DescriptionsBySourceType {
-		stsum += st + 1
+		types = append(types, st.String())
 	}
+	sort.Strings(types)
 
-	io.WriteString(h, repoDb.Repo.Name+repoDb.Repo.URL+fmt.Sprint(stsum)+rVersion)
+	io.WriteString(h, repoDb.Repo.Name+repoDb.Repo.URL+repoDb.Repo.BinaryURL+strings.Join(types, ",")+rVersion)
+	if _, ok := repoDb.DescriptionsBySourceType[Binary]; ok {
+		// the binaries available differ by platform
+		io.WriteString(h, repoDb.Platform.String()+getLinuxBinaryUri(repoDb.Platform))
+	}
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
 // GetPackagesFileURL provides the base URL for a package in a cran-like repo given the source type and version of R
 func GetPackagesFileURL(r *RepoDb, st SourceType, rv RVersion) string {
+	p := r.Platform.orLocal()
 	if st == Source {
 		return fmt.Sprintf("%s/src/contrib/PACKAGES", strings.TrimSuffix(r.Repo.URL, "/"))
 		// TODO: fix so isn't hard coded to 3.5 binaries
 	}
-	if r.RepoSuffix != "" && runtime.GOOS == "linux" {
+	if r.Repo.BinaryURL != "" {
+		return fmt.Sprintf("%s/src/contrib/PACKAGES", strings.TrimSuffix(r.Repo.BinaryURL, "/"))
+	}
+	if r.RepoSuffix != "" && p.OS == "linux" {
 		// reposuffix should only be noted if on linux
-		return fmt.Sprintf("%s/bin/%s/%s/contrib/%s/PACKAGES", strings.TrimSuffix(r.Repo.URL, "/"), cranBinaryURL(rv), r.RepoSuffix, rv.ToString())
+		return fmt.Sprintf("%s/bin/%s/%s/contrib/%s/PACKAGES", strings.TrimSuffix(r.Repo.URL, "/"), cranBinaryURL(rv, p), r.RepoSuffix, rv.ToString())
 	}
-	return fmt.Sprintf("%s/bin/%s/contrib/%s/PACKAGES", strings.TrimSuffix(r.Repo.URL, "/"), cranBinaryURL(rv), rv.ToString())
+	return fmt.Sprintf("%s/bin/%s/contrib/%s/PACKAGES", strings.TrimSuffix(r.Repo.URL, "/"), cranBinaryURL(rv, p), rv.ToString())
 }
 
 // FetchPackages gets the packages for  RepoDb
 // R_AVAILABLE_PACKAGES_CACHE_CONTROL_MAX_AGE controls the timing to requery the cache in R
-// noSecure will allow https fetching without validating the certificate chain.
-// This occasionally is needed for repos that have self signed or certs not fully verifiable
-// which will return errors such as x509: certificate signed by unknown authority
+// noSecure skips validating the certificate chain, see NewPkgDb.
 func (repoDb *RepoDb) FetchPackages(rVersion RVersion, noSecure bool) error {
-	var err error
 	pkgdbFile := repoDb.GetRepoDbCacheFilePath(rVersion.ToFullString())
 
+	if repoDb.offline {
+		fi, err := os.Stat(pkgdbFile)
+		if err != nil {
+			return fmt.Errorf("offline and no cached repo information for %s (%s) with R %s, expected at %s",
+				repoDb.Repo.Name, repoDb.Repo.URL, rVersion.ToFullString(), pkgdbFile)
+		}
+		log.WithFields(log.Fields{
+			"repo": repoDb.Repo.Name,
+			"age":  time.Since(fi.ModTime()).Round(time.Second),
+		}).Debug("offline, using cached repo information")
+		if err := repoDb.Decode(pkgdbFile); err != nil {
+			return fmt.Errorf("offline and cached repo information for %s at %s cannot be used: %s", repoDb.Repo.Name, pkgdbFile, err)
+		}
+		repoDb.setIndexURLs(readValidators(pkgdbFile))
+		return nil
+	}
+
 	if fi, err := os.Stat(pkgdbFile); !os.IsNotExist(err) {
 		maxSecs := 3600
 		maxAge, ok := os.LookupEnv("R_AVAILABLE_PACKAGES_CACHE_CONTROL_MAX_AGE")
@@ -133,126 +189,106 @@ func (repoDb *RepoDb) FetchPackages(rVersion RVersion, noSecure bool) error {
 		}
 		if fi.ModTime().Add(time.Duration(maxSecs)*time.Second).Unix() > time.Now().Unix() {
 			// only read if was cached in the last hour
-			return repoDb.Decode(pkgdbFile)
+			err := repoDb.Decode(pkgdbFile)
+			if err == nil {
+				repoDb.setIndexURLs(readValidators(pkgdbFile))
+				return nil
+			}
+			// such as a cache written by an older version of pkgr, so fetch again
+			discardUnreadableCache(repoDb.Repo, pkgdbFile, err)
 		}
-		err := os.Remove(pkgdbFile)
-		if err != nil {
-			fmt.Println("error removing cache ", pkgdbFile, err)
+	}
+
+	// once stale, the cached information is kept so it can be revalidated
+	// rather than fetching every PACKAGES file again
+	cached := &RepoDb{Repo: repoDb.Repo}
+	validators := make(map[SourceType]indexValidators)
+	if _, err := os.Stat(pkgdbFile); err == nil {
+		if err := cached.Decode(pkgdbFile); err == nil {
+			validators = readValidators(pkgdbFile)
+		} else {
+			discardUnreadableCache(repoDb.Repo, pkgdbFile, err)
 		}
 	}
 
 	type downloadDatabase struct {
 		St                    SourceType
-		AvailableDescriptions map[string]desc.Desc
+		AvailableDescriptions map[string][]desc.Desc
+		Validators            indexValidators
+		NotModified           bool
 		Err                   error
 	}
 
-	client := &http.Client{}
-	if noSecure {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify : true},
-		}
-		client = &http.Client{Transport: tr}
-	}
-
 	downloadChannel := make(chan downloadDatabase, len(repoDb.DescriptionsBySourceType))
 	defer close(downloadChannel)
 
 	for sourceType := range repoDb.DescriptionsBySourceType {
 		go func(st SourceType) {
-			descriptionMap := make(map[string]desc.Desc)
-			pkgURL := GetPackagesFileURL(repoDb, st, rVersion)
+			descriptionMap := make(map[string][]desc.Desc)
+			pkgURL := strings.TrimSuffix(GetPackagesFileURL(repoDb, st, rVersion), "/PACKAGES")
 			log.Debugf("packages database - type: %s, url: %s\n", st, pkgURL)
-			var body []byte
-
-			if strings.HasPrefix(pkgURL, "http") {
-				res, err := client.Get(pkgURL)
-				if err != nil {
-					log.Error("error with http get to url: " + pkgURL)
-					log.Fatal(err)
-				}
-				if res.StatusCode != 200 {
-					downloadChannel <- downloadDatabase{
-						St:                    st,
-						AvailableDescriptions: descriptionMap,
-						Err:                   fmt.Errorf("failed fetching PACKAGES file from %s, with status %s", pkgURL, res.Status)}
-					return
-				}
-				if err != nil {
-					err = fmt.Errorf("problem getting packages from url %s: %s", pkgURL, err)
-					downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
-					return
-				}
-
-				defer res.Body.Close()
-				body, err = ioutil.ReadAll(res.Body)
-				if err != nil {
-					err = fmt.Errorf("error reading body: %s", err)
-					downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
-					return
-				}
-
-			} else {
-				pkgdir, _ := homedir.Expand(pkgURL)
-				pkgdir, _ = filepath.Abs(pkgdir)
-				if fi, err := os.Open(pkgdir); !os.IsNotExist(err) {
-					body, err = ioutil.ReadAll(fi)
-					fi.Close()
-				} else {
-					err = fmt.Errorf("no package file found at: %s", pkgdir)
-					downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
-					return
+			cachedDescriptions, isCached := cached.DescriptionsBySourceType[st]
+			index, err := fetchMirroredIndex(repoDb.Repo, pkgURL, noSecure, validators[st], isCached)
+			if err != nil {
+				downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
+				return
+			}
+			if index.NotModified {
+				log.WithFields(log.Fields{
+					"repo": repoDb.Repo.Name,
+					"type": st,
+				}).Debug("cached packages database still current")
+				downloadChannel <- downloadDatabase{
+					St:                    st,
+					AvailableDescriptions: cachedDescriptions,
+					Validators:            index.Validators,
+					NotModified:           true,
 				}
+				return
+			}
+			log.WithFields(log.Fields{
+				"repo": repoDb.Repo.Name,
+				"type": st,
+				"url":  index.URL,
+			}).Debug("fetched packages database")
+			fetchedValidators := index.Validators
+			if fetchedValidators.URL == "" {
+				fetchedValidators.URL = index.URL
+			}
+			// every version is kept, leaving the choice of version compatible
+			// with the R version and constraints to the package database.
+			// The path will be set if its a special version of the package located in a
+			// subdirectory, such as an older build, or the recommended packages for an R version
+			err = desc.ParseDescs(index.Body, runtime.NumCPU(), func(pkgDesc desc.Desc) {
+				addDescription(descriptionMap, pkgDesc)
+			})
+			index.Body.Close()
+			if err != nil {
+				err = fmt.Errorf("problem parsing %s: %s", index.URL, err)
+				downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
+				return
 			}
-			// cran windows PACKAGES file can have windows carriage returns, lets normalize
-			body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
-			parsedPackagesFile := bytes.Split(body, []byte("\n\n"))
 			log.WithFields(log.Fields{
 				"url":      pkgURL,
-				"num_pkgs": len(parsedPackagesFile),
+				"num_pkgs": len(descriptionMap),
 			}).Debug("potential packages")
-			for _, pkg := range parsedPackagesFile {
-				if len(pkg) == 0 {
-					// end of file might have double spaces
-					// and thus will be one split, so want
-					// to skip that
-					//todo: trim this before the loop
-					continue
-				}
-				reader := bytes.NewReader(pkg)
-				pkgDesc, err := desc.ParseDesc(reader)
 
-				if err != nil {
-					fmt.Println("problem parsing package with info ", string(pkg))
-					fmt.Println(err)
-					downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
-					return
-				}
-
-				pkgRConstraint, packageValid := isRVersionCompatible(pkgDesc, rVersion)
-
-				// the path will be set to a character if its a special version of the package,
-				// such as an older type, or a newer type in prep for a new R version release
-				// as such, for now we'll just discard if its one of those until we can
-				// more comprehensively teach pkgr what it should do in such a situation
-				if packageValid && pkgDesc.Path == "" {
-					descriptionMap[pkgDesc.Package] = pkgDesc
-				} else {
-					log.WithFields(log.Fields{
-						"pkg":     pkgDesc.Package,
-						"version": pkgRConstraint.ToString(),
-					}).Debug("invalid package constraint")
-				}
-			}
-
-			downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Err: err}
+			downloadChannel <- downloadDatabase{St: st, AvailableDescriptions: descriptionMap, Validators: fetchedValidators, Err: err}
 		}(sourceType)
 
 	}
 	errorCount := 0
+	notModifiedCount := 0
 	var lasterr error
+	newValidators := make(map[SourceType]indexValidators)
 	for i := 0; i < len(repoDb.DescriptionsBySourceType); i++ {
 		result := <-downloadChannel
+		if result.NotModified {
+			notModifiedCount++
+		}
+		if !result.Validators.isEmpty() {
+			newValidators[result.St] = result.Validators
+		}
 		if result.Err != nil {
 			log.Warnf("error downloading repo %s, type: %s, with information: %s\n", repoDb.Repo.Name, result.St, result.Err)
 			errorCount++
@@ -268,7 +304,20 @@ func (repoDb *RepoDb) FetchPackages(rVersion RVersion, noSecure bool) error {
 		return lasterr
 	}
 
-	return repoDb.Encode(pkgdbFile)
+	repoDb.setIndexURLs(newValidators)
+	if notModifiedCount == len(repoDb.DescriptionsBySourceType) {
+		// nothing changed, so only the time the cache was last validated needs updating
+		now := time.Now()
+		return os.Chtimes(pkgdbFile, now, now)
+	}
+	repoDb.Time = time.Now()
+	if err := repoDb.Encode(pkgdbFile, rVersion); err != nil {
+		return err
+	}
+	if err := writeValidators(pkgdbFile, newValidators); err != nil {
+		log.WithField("error", err).Debug("could not store packages database validators")
+	}
+	return nil
 }
 
 func isRVersionCompatible(pkgDesc desc.Desc, rVersion RVersion) (desc.Dep, bool) {
@@ -310,21 +359,20 @@ func checkRVersionCompatibility(rVersion RVersion, pkgRConstraint desc.Dep) bool
 
 //GetRepoDbCacheFilePath Get the filename of the file in the cache that will store this RepoDB
 func (repoDb *RepoDb) GetRepoDbCacheFilePath(rVersion string) string {
-	cdir, err := os.UserCacheDir()
-	if err != nil {
-		fmt.Println("could not use user cache dir, using temp dir")
-		cdir = os.TempDir()
-	}
-	return (filepath.Join(cdir, "pkgr", "r_packagedb_caches", repoDb.Hash(rVersion)))
+	return filepath.Join(RepoDbCacheDir(), repoDb.Hash(rVersion))
 }
 
 // GetPackageDbFilePath get the filepath for the cached pkgdbs
 func (repoDb *RepoDb) GetPackageDbFilePath(rVersion string) string {
-	cdir, err := os.UserCacheDir()
-	if err != nil {
-		fmt.Println("could not use user cache dir, using temp dir")
-		cdir = os.TempDir()
+	return filepath.Join(RepoDbCacheDir(), repoDb.Hash(rVersion))
+}
+
+// setIndexURLs records the variant of the PACKAGES index used for each source type
+func (repoDb *RepoDb) setIndexURLs(validators map[SourceType]indexValidators) {
+	repoDb.IndexURLs = make(map[SourceType]string)
+	for st, v := range validators {
+		if v.URL != "" {
+			repoDb.IndexURLs[st] = v.URL
+		}
 	}
-	pkgdbHash := repoDb.Hash(rVersion)
-	return filepath.Join(cdir, "pkgr", "r_packagedb_caches", pkgdbHash)
 }
@@ -272,3 +272,22 @@ func (suite *RepoDbTestSuite) TestIsRVersionCompatible_InvalidEqualsInstalledVer
 
 	suite.False(actual, "R package is invalid")
 }
+
+func (suite *RepoDbTestSuite) TestHash_BySourceTypes() {
+	newDb := func(types ...SourceType) *RepoDb {
+		db := &RepoDb{
+			Repo:                     RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"},
+			DescriptionsBySourceType: make(map[SourceType]map[string][]desc.Desc),
+		}
+		for _, st := range types {
+			db.DescriptionsBySourceType[st] = make(map[string][]desc.Desc)
+		}
+		return db
+	}
+	source := newDb(Source).Hash("4.2")
+	both := newDb(Source, Binary).Hash("4.2")
+
+	suite.NotEqual(source, both, "source only and source/binary repos use different caches")
+	suite.Equal(both, newDb(Binary, Source).Hash("4.2"), "the hash does not depend on the order of the types")
+	suite.NotEqual(source, newDb(Binary).Hash("4.2"))
+}
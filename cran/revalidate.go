@@ -0,0 +1,63 @@
+package cran
+
+import (
+	"encoding/gob"
+	"os"
+)
+
+// indexValidators are the http cache validators returned when fetching a PACKAGES file,
+// used to cheaply check whether the cached repo information is still current
+type indexValidators struct {
+	// URL is the index variant the validators are for
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+func newIndexValidators(url string, res *TransportResponse) indexValidators {
+	return indexValidators{
+		URL:          url,
+		ETag:         res.ETag,
+		LastModified: res.LastModified,
+	}
+}
+
+func (v indexValidators) isEmpty() bool {
+	return v.URL == "" && v.ETag == "" && v.LastModified == ""
+}
+
+// apply makes the request conditional, so the transport responds with
+// NotModified if the file has not changed since it was cached
+func (v indexValidators) apply(req *TransportRequest) {
+	req.ETag = v.ETag
+	req.LastModified = v.LastModified
+}
+
+// validatorsFilePath provides the file the validators are stored in, next to the cached repo db
+func validatorsFilePath(pkgdbFile string) string {
+	return pkgdbFile + ".validators"
+}
+
+// readValidators reads the validators stored for a cached repo db.
+// Missing or unreadable validators simply result in a full fetch.
+func readValidators(pkgdbFile string) map[SourceType]indexValidators {
+	validators := make(map[SourceType]indexValidators)
+	f, err := os.Open(validatorsFilePath(pkgdbFile))
+	if err != nil {
+		return validators
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&validators); err != nil {
+		return make(map[SourceType]indexValidators)
+	}
+	return validators
+}
+
+func writeValidators(pkgdbFile string, validators map[SourceType]indexValidators) error {
+	f, err := os.Create(validatorsFilePath(pkgdbFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(validators)
+}
@@ -0,0 +1,68 @@
+package cran
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchPackagesRevalidation(t *testing.T) {
+	os.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	// always consider the cache stale so it is revalidated
+	os.Setenv("R_AVAILABLE_PACKAGES_CACHE_CONTROL_MAX_AGE", "0")
+	defer os.Unsetenv("R_AVAILABLE_PACKAGES_CACHE_CONTROL_MAX_AGE")
+
+	etag := `"v1"`
+	packages := "Package: pkgA\nVersion: 1.0.0\n"
+	var fullFetches, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullFetches++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(packages))
+	}))
+	defer server.Close()
+
+	rv := RVersion{Major: 4, Minor: 1, Patch: 2}
+	fetch := func() *RepoDb {
+		db := &RepoDb{
+			DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+			Repo:                     RepoURL{Name: "CRAN", URL: server.URL},
+		}
+		require.NoError(t, db.FetchPackages(rv, false))
+		return db
+	}
+
+	db := fetch()
+	assert.Equal(t, "1.0.0", db.DescriptionsBySourceType[Source]["pkgA"][0].Version)
+	assert.Equal(t, 1, fullFetches)
+
+	cacheFile := db.GetRepoDbCacheFilePath(rv.ToFullString())
+	stale := time.Now().Add(-24 * time.Hour)
+	require.NoError(t, os.Chtimes(cacheFile, stale, stale))
+	db = fetch()
+	assert.Equal(t, "1.0.0", db.DescriptionsBySourceType[Source]["pkgA"][0].Version)
+	assert.Equal(t, 1, fullFetches)
+	assert.Equal(t, 1, notModified)
+	fi, err := os.Stat(cacheFile)
+	require.NoError(t, err)
+	assert.True(t, fi.ModTime().After(stale), "revalidated cache should have its timestamp refreshed")
+
+	etag = `"v2"`
+	packages = "Package: pkgA\nVersion: 2.0.0\n"
+	db = fetch()
+	assert.Equal(t, "2.0.0", db.DescriptionsBySourceType[Source]["pkgA"][0].Version)
+	assert.Equal(t, 2, fullFetches)
+	assert.Equal(t, 1, notModified)
+}
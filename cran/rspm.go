@@ -0,0 +1,155 @@
+package cran
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// rspmSnapshotRegex matches the frozen snapshots of a Posit Package Manager repo,
+// either a date such as 2021-11-01 or a numeric snapshot id
+var rspmSnapshotRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}|\d+)$`)
+
+// RSPMSnapshotURL rewrites the url of a Posit Package Manager repo, such as
+// https://packagemanager.posit.co/cran/latest, to the given snapshot date or id
+func RSPMSnapshotURL(url string, snapshot string) (string, error) {
+	if !rspmSnapshotRegex.MatchString(snapshot) {
+		return "", fmt.Errorf("invalid snapshot %s, must be a date (YYYY-MM-DD) or snapshot id", snapshot)
+	}
+	url = strings.TrimSuffix(url, "/")
+	i := strings.LastIndex(url, "/")
+	last := url[i+1:]
+	if last == "latest" || rspmSnapshotRegex.MatchString(last) {
+		url = url[:i]
+	}
+	return url + "/" + snapshot, nil
+}
+
+// rspmLinuxDistro provides the distribution name Posit Package Manager
+// serves Linux binaries under for the platform, eg focal or centos7,
+// or an empty string when it is unknown
+func rspmLinuxDistro(p Platform) string {
+	if p.OS != "linux" {
+		return ""
+	}
+	switch p.Distro.Id {
+	case "ubuntu", "debian":
+		return p.Distro.VersionCodename
+	case "centos", "rhel", "rocky", "almalinux":
+		if p.Distro.VersionId == "" {
+			return ""
+		}
+		major := strings.Split(p.Distro.VersionId, ".")[0]
+		if p.Distro.Id == "centos" && major == "7" {
+			return "centos7"
+		}
+		return "rhel" + major
+	}
+	return ""
+}
+
+// rspmLinuxURL provides the url Posit Package Manager serves the Linux binaries
+// for distro from, inserting __linux__/<distro> ahead of the snapshot of the repo url
+func rspmLinuxURL(url string, distro string) string {
+	url = strings.TrimSuffix(url, "/")
+	if strings.Contains(url, "/__linux__/") {
+		return url
+	}
+	i := strings.LastIndex(url, "/")
+	return fmt.Sprintf("%s/__linux__/%s/%s", url[:i], distro, url[i+1:])
+}
+
+// rspmLinuxRepo configures a Posit Package Manager repo to fetch Linux binaries,
+// which are only served given an R style User-Agent, returning false if binaries
+// are not available for the platform
+func rspmLinuxRepo(r RepoURL, rv RVersion, p Platform) (RepoURL, bool) {
+	distro := rspmLinuxDistro(p)
+	if distro == "" {
+		return r, false
+	}
+	r.BinaryURL = rspmLinuxURL(r.URL, distro)
+	r.UserAgent = rUserAgent(rv, p)
+	return r, true
+}
+
+// rUserAgent provides the User-Agent R sends with requests, such as
+// R (4.1.2 x86_64-pc-linux-gnu x86_64 linux-gnu)
+func rUserAgent(rv RVersion, p Platform) string {
+	return fmt.Sprintf("R (%s %s %s %s)", rv.ToFullString(), p, p.Arch, p.osName())
+}
+
+// isBinaryTarball checks whether the tarball at path is a built package, as
+// a repo may serve the source package when no binary is available under the same name.
+// Built packages always contain the Meta directory, which source packages never do
+func isBinaryTarball(fs afero.Fs, path string, pkg string) (bool, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return false, err
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if strings.HasPrefix(strings.TrimPrefix(hdr.Name, "./"), pkg+"/Meta/") {
+			return true, nil
+		}
+	}
+}
+
+// binaryFallbackPath provides where a source package served in place of the binary
+// at dest is kept in the package cache, the src directory alongside binary/<R version>
+func binaryFallbackPath(dest string, d PkgDl) string {
+	binaryDir := filepath.Dir(filepath.Dir(dest))
+	if filepath.Base(binaryDir) != "binary" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(binaryDir), "src", fmt.Sprintf("%s_%s.tar.gz", d.Package.Package, d.Package.Version))
+}
+
+// servedPackage checks whether a binary or the source package was served for a binary
+// download to dest, moving a source package to the src directory of the package cache
+// so it is built on install
+func servedPackage(fs afero.Fs, d PkgDl, dest string, size int64) (Download, error) {
+	binary, err := isBinaryTarball(fs, dest, d.Package.Package)
+	if err != nil {
+		fs.Remove(dest)
+		return Download{Metadata: d}, &DownloadError{Package: d.Package.Package, URL: d.Config.Repo.BinaryURL, Err: err}
+	}
+	if binary {
+		return Download{Path: dest, New: true, Metadata: d, Size: size}, nil
+	}
+	srcDest := binaryFallbackPath(dest, d)
+	if srcDest == "" {
+		return Download{Metadata: d}, fmt.Errorf("source package served for binary %s at %s outside of the package cache", d.Package.Package, dest)
+	}
+	if err := fs.MkdirAll(filepath.Dir(srcDest), 0777); err != nil {
+		return Download{Metadata: d}, err
+	}
+	if err := fs.Rename(dest, srcDest); err != nil {
+		return Download{Metadata: d}, err
+	}
+	log.WithFields(log.Fields{
+		"package": d.Package.Package,
+		"repo":    d.Config.Repo.Name,
+	}).Info("no binary available, using source package")
+	d.Config.Type = Source
+	return Download{Path: srcDest, New: true, Metadata: d, Size: size}, nil
+}
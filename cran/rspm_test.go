@@ -0,0 +1,135 @@
+package cran
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSPMSnapshotURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		snapshot string
+		expected string
+		err      bool
+	}{
+		{"https://packagemanager.posit.co/cran/latest", "2021-11-01", "https://packagemanager.posit.co/cran/2021-11-01", false},
+		{"https://packagemanager.posit.co/cran/latest/", "1234567", "https://packagemanager.posit.co/cran/1234567", false},
+		{"https://packagemanager.posit.co/cran/2020-01-01", "2021-11-01", "https://packagemanager.posit.co/cran/2021-11-01", false},
+		{"https://rspm.company.com/internal", "2021-11-01", "https://rspm.company.com/internal/2021-11-01", false},
+		{"https://packagemanager.posit.co/cran/latest", "yesterday", "", true},
+	}
+	for _, tt := range tests {
+		actual, err := RSPMSnapshotURL(tt.url, tt.snapshot)
+		if tt.err {
+			assert.Error(t, err, tt.snapshot)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, actual)
+	}
+}
+
+func TestRSPMLinuxURL(t *testing.T) {
+	assert.Equal(t, "https://packagemanager.posit.co/cran/__linux__/focal/latest", rspmLinuxURL("https://packagemanager.posit.co/cran/latest", "focal"))
+	assert.Equal(t, "https://packagemanager.posit.co/cran/__linux__/rhel9/2021-11-01", rspmLinuxURL("https://packagemanager.posit.co/cran/2021-11-01/", "rhel9"))
+	assert.Equal(t, "https://packagemanager.posit.co/cran/__linux__/jammy/latest", rspmLinuxURL("https://packagemanager.posit.co/cran/__linux__/jammy/latest", "focal"))
+}
+
+func TestRUserAgent(t *testing.T) {
+	p := Platform{OS: "linux", Arch: "x86_64", Vendor: "pc"}
+	assert.Equal(t, "R (4.1.2 x86_64-pc-linux-gnu x86_64 linux-gnu)", rUserAgent(RVersion{Major: 4, Minor: 1, Patch: 2}, p))
+	p = Platform{OS: "linux", Arch: "aarch64", Vendor: "unknown"}
+	assert.Equal(t, "R (4.3.0 aarch64-unknown-linux-gnu aarch64 linux-gnu)", rUserAgent(RVersion{Major: 4, Minor: 3, Patch: 0}, p))
+}
+
+// writeTestBinaryTarball writes a minimal built package tarball into dir,
+// named as Posit Package Manager serves it
+func writeTestBinaryTarball(t *testing.T, dir string, pkg string, version string) {
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s_%s.tar.gz", pkg, version)))
+	require.NoError(t, err)
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	files := map[string]string{
+		pkg + "/DESCRIPTION":      fmt.Sprintf("Package: %s\nVersion: %s\nBuilt: R 4.1.2; ; 2021-11-01; unix\n", pkg, version),
+		pkg + "/Meta/package.rds": "rds",
+	}
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err = tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+}
+
+func TestDownloadRSPMBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pkgr-rspm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	contrib := filepath.Join(dir, "cran", "__linux__", "focal", "latest", "src", "contrib")
+	writeTestBinaryTarball(t, contrib, "pkgA", "1.0.0")
+	// no binary is available for pkgB, so the source package is served
+	writeTestTarball(t, contrib, "pkgB", "1.0.0", "")
+
+	userAgent := "R (4.1.2 x86_64-pc-linux-gnu x86_64 linux-gnu)"
+	files := http.FileServer(http.Dir(dir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != userAgent {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	repo := RepoURL{
+		Name:      "RSPM",
+		URL:       srv.URL + "/cran/latest",
+		BinaryURL: srv.URL + "/cran/__linux__/focal/latest",
+		UserAgent: userAgent,
+	}
+	cache := filepath.Join(dir, "cache", RepoURLHash(repo))
+	fs := afero.NewOsFs()
+	require.NoError(t, fs.MkdirAll(filepath.Join(cache, "binary", "4.1"), 0755))
+	for _, tt := range []struct {
+		pkg      string
+		expected SourceType
+		path     string
+	}{
+		{"pkgA", Binary, filepath.Join(cache, "binary", "4.1", "pkgA_1.0.0_R_x86_64-pc-linux-gnu.tar.gz")},
+		{"pkgB", Source, filepath.Join(cache, "src", "pkgB_1.0.0.tar.gz")},
+	} {
+		d := PkgDl{
+			Package: desc.Desc{Package: tt.pkg, Version: "1.0.0", MD5sum: "not-the-binary"},
+			Config:  PkgConfig{Repo: repo, Type: Binary},
+		}
+		dest := filepath.Join(cache, "binary", "4.1", tt.pkg+"_1.0.0_R_x86_64-pc-linux-gnu.tar.gz")
+		dl, err := DownloadPackage(fs, d, dest, RVersion{Major: 4, Minor: 1, Patch: 2}, Platform{}, false, false, false)
+		require.NoError(t, err, tt.pkg)
+		assert.True(t, dl.New, tt.pkg)
+		assert.Equal(t, tt.expected, dl.Metadata.Config.Type, tt.pkg)
+		assert.Equal(t, tt.path, dl.Path, tt.pkg)
+		assert.FileExists(t, tt.path)
+
+		// later runs use the cached package, even when the source was served
+		dl, err = DownloadPackage(fs, d, dest, RVersion{Major: 4, Minor: 1, Patch: 2}, Platform{}, false, false, true)
+		require.NoError(t, err, tt.pkg)
+		assert.False(t, dl.New, tt.pkg)
+		assert.Equal(t, tt.expected, dl.Metadata.Config.Type, tt.pkg)
+		assert.Equal(t, tt.path, dl.Path, tt.pkg)
+	}
+}
@@ -0,0 +1,42 @@
+package cran
+
+import (
+	"fmt"
+	"path"
+)
+
+// Validate checks the Include and Exclude patterns of the repo are well formed
+func (rc RepoConfig) Validate() error {
+	for _, p := range append(append([]string{}, rc.Include...), rc.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid package pattern %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// allowsPackage reports whether the Include and Exclude patterns of the repo
+// permit it to provide the package
+func (rc RepoConfig) allowsPackage(pkg string) bool {
+	if len(rc.Include) > 0 && !matchesAny(pkg, rc.Include) {
+		return false
+	}
+	return !matchesAny(pkg, rc.Exclude)
+}
+
+func matchesAny(pkg string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, pkg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// repoAllows reports whether the repo is permitted to provide the package
+func (pkgNexus *PkgNexus) repoAllows(r RepoURL, pkg string) bool {
+	if pkgNexus.Config == nil {
+		return true
+	}
+	return pkgNexus.Config.Repos[r.Name].allowsPackage(pkg)
+}
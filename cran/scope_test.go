@@ -0,0 +1,72 @@
+package cran
+
+import (
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoConfigAllowsPackage(t *testing.T) {
+	tests := []struct {
+		name    string
+		rc      RepoConfig
+		pkg     string
+		allowed bool
+	}{
+		{"no patterns", RepoConfig{}, "dplyr", true},
+		{"included", RepoConfig{Include: []string{"metrum*"}}, "metrumrg", true},
+		{"not included", RepoConfig{Include: []string{"metrum*"}}, "dplyr", false},
+		{"any include pattern", RepoConfig{Include: []string{"metrum*", "mrg?"}}, "mrgx", true},
+		{"excluded", RepoConfig{Exclude: []string{"metrum*"}}, "metrumrg", false},
+		{"not excluded", RepoConfig{Exclude: []string{"metrum*"}}, "dplyr", true},
+		{"exclude wins over include", RepoConfig{Include: []string{"metrum*"}, Exclude: []string{"metrumrg"}}, "metrumrg", false},
+		{"patterns are case sensitive", RepoConfig{Include: []string{"metrum*"}}, "Metrumrg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, tt.rc.allowsPackage(tt.pkg))
+		})
+	}
+}
+
+func TestRepoConfigValidate(t *testing.T) {
+	assert.NoError(t, RepoConfig{Include: []string{"metrum*", "pkg[AB]"}}.Validate())
+	assert.EqualError(t, RepoConfig{Exclude: []string{"pkg[AB"}}.Validate(), `invalid package pattern "pkg[AB": syntax error in pattern`)
+}
+
+func TestGetPackageScopedRepos(t *testing.T) {
+	internal := newTestRepoDb(RepoURL{Name: "internal", URL: "https://rpkgs.example.com"},
+		desc.Desc{Package: "metrumrg", Version: "2.0.0"},
+		// typo-squatted or accidentally uploaded
+		desc.Desc{Package: "dplyr", Version: "9.9.9"},
+	)
+	cranDb := newTestRepoDb(RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"},
+		desc.Desc{Package: "metrumrg", Version: "3.0.0"},
+		desc.Desc{Package: "dplyr", Version: "1.0.7"},
+	)
+	pkgNexus := newTestNexus(internal, cranDb)
+	pkgNexus.Config.Repos = map[string]RepoConfig{
+		"internal": {Include: []string{"metrum*"}},
+		"CRAN":     {Exclude: []string{"metrum*"}},
+	}
+
+	d, cfg, ok := pkgNexus.GetPackage("dplyr")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.7", d.Version)
+	assert.Equal(t, "CRAN", cfg.Repo.Name)
+
+	_, _, ok = pkgNexus.GetPackageFromRepo("dplyr", "internal")
+	assert.False(t, ok)
+
+	d, cfg, ok = pkgNexus.GetPackage("metrumrg")
+	assert.True(t, ok)
+	assert.Equal(t, "2.0.0", d.Version)
+	assert.Equal(t, "internal", cfg.Repo.Name)
+	assert.Equal(t, []string{"2.0.0 (internal, source)"}, pkgNexus.GetAvailableVersions("metrumrg"))
+
+	// a package pinned to a repo is still subject to its patterns
+	assert.NoError(t, pkgNexus.SetPackageRepo("dplyr", "internal"))
+	_, _, ok = pkgNexus.GetPackage("dplyr")
+	assert.False(t, ok)
+}
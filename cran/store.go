@@ -0,0 +1,240 @@
+package cran
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dpastoor/goutils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+// PackageStore is the content addressed store within the package cache, shared by every repo.
+// Package files are kept once in the store, keyed by their md5 sum, with the
+// <repo>/src and <repo>/binary/<R version> layout of the cache holding links to them,
+// so the same tarball resolved from different repos is only downloaded and kept once.
+type PackageStore struct {
+	Fs  afero.Fs
+	Dir string
+}
+
+// NewPackageStore provides the store within the package cache at cacheDir
+func NewPackageStore(fs afero.Fs, cacheDir string) PackageStore {
+	return PackageStore{Fs: fs, Dir: filepath.Join(cacheDir, "store")}
+}
+
+// ObjectPath provides where the package file with the md5 sum is stored
+func (s PackageStore) ObjectPath(md5sum string) string {
+	sum := normalizeSum(md5sum)
+	return filepath.Join(s.Dir, "md5", sum[:2], sum)
+}
+
+// BuiltPath provides where the binary built from the source tarball with the md5 sum
+// srcSum is stored, for the R version (major.minor) and platform it was built with
+func (s PackageStore) BuiltPath(srcSum string, rVersion string, platform string) string {
+	sum := normalizeSum(srcSum)
+	return filepath.Join(s.Dir, "built", rVersion, platform, sum[:2], sum)
+}
+
+func normalizeSum(sum string) string {
+	sum = strings.ToLower(strings.TrimSpace(sum))
+	for len(sum) < 2 {
+		sum = "0" + sum
+	}
+	return sum
+}
+
+// Restore links dest to the stored package file with the md5 sum, if any,
+// returning whether dest now refers to it
+func (s PackageStore) Restore(md5sum string, dest string) bool {
+	if md5sum == "" {
+		return false
+	}
+	if exists, _ := goutils.Exists(s.Fs, dest); exists {
+		return false
+	}
+	ok, err := s.Link(s.ObjectPath(md5sum), dest)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  dest,
+			"error": err,
+		}).Warn("could not link package from the package store")
+		return false
+	}
+	return ok
+}
+
+// Put adds the package file at path to the store under its md5 sum, which is
+// computed when not given. Should an identical file already be stored,
+// path is replaced by a link to it so only the one copy is kept.
+func (s PackageStore) Put(path string, md5sum string) error {
+	if md5sum == "" {
+		sum, err := FileMD5(s.Fs, path)
+		if err != nil {
+			return err
+		}
+		md5sum = sum
+	}
+	obj := s.ObjectPath(md5sum)
+	if s.sameFile(obj, path) {
+		return nil
+	}
+	if exists, _ := goutils.Exists(s.Fs, obj); exists {
+		// only share the stored file if it has not been corrupted
+		if sum, err := FileMD5(s.Fs, obj); err == nil && sum == normalizeSum(md5sum) {
+			return s.link(obj, path)
+		}
+	}
+	return s.Add(obj, path)
+}
+
+// Add stores the file at ref as obj, replacing anything stored there already
+func (s PackageStore) Add(obj string, ref string) error {
+	if err := s.Fs.MkdirAll(filepath.Dir(obj), 0777); err != nil {
+		return err
+	}
+	return s.link(ref, obj)
+}
+
+// Link links ref to the file stored at obj, returning false when nothing is stored there
+func (s PackageStore) Link(obj string, ref string) (bool, error) {
+	if exists, err := goutils.Exists(s.Fs, obj); !exists || err != nil {
+		return false, err
+	}
+	if err := s.Fs.MkdirAll(filepath.Dir(ref), 0777); err != nil {
+		return false, err
+	}
+	if err := s.link(obj, ref); err != nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{
+		"path":   ref,
+		"stored": obj,
+	}).Trace("linked from package store")
+	return true, nil
+}
+
+// link replaces dst with a hard link to src, copying src instead where links are not
+// supported, such as across devices. dst is replaced atomically so concurrent
+// readers never see a partial file.
+func (s PackageStore) link(src string, dst string) error {
+	tmp := fmt.Sprintf("%s.%d.tmp", dst, time.Now().UnixNano())
+	linked := false
+	if _, ok := s.Fs.(*afero.OsFs); ok {
+		linked = os.Link(src, tmp) == nil
+	}
+	if !linked {
+		if err := copyFile(s.Fs, src, tmp); err != nil {
+			s.Fs.Remove(tmp)
+			return err
+		}
+	}
+	if err := s.Fs.Rename(tmp, dst); err != nil {
+		s.Fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// sameFile checks whether both paths refer to the same file, as for a hard link
+func (s PackageStore) sameFile(a string, b string) bool {
+	if _, ok := s.Fs.(*afero.OsFs); !ok {
+		return false
+	}
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
+
+// Prune removes stored files no longer linked from anywhere else in the package cache,
+// such as once the repo directories referring to them have been cleaned.
+// Only stores on the os file system can be pruned, as links are not tracked otherwise.
+func (s PackageStore) Prune() (int, error) {
+	if _, ok := s.Fs.(*afero.OsFs); !ok {
+		return 0, nil
+	}
+	// files outside the store by size, to check the stored files against
+	refs := make(map[int64][]os.FileInfo)
+	err := filepath.Walk(filepath.Dir(s.Dir), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && path == s.Dir {
+			return filepath.SkipDir
+		}
+		if fi.Mode().IsRegular() {
+			refs[fi.Size()] = append(refs[fi.Size()], fi)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	err = filepath.Walk(s.Dir, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == s.Dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		for _, ref := range refs[fi.Size()] {
+			if os.SameFile(fi, ref) {
+				return nil
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		log.WithField("path", path).Trace("removed unreferenced file from package store")
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// FileMD5 provides the md5 sum of a file as a lower case hex string
+func FileMD5(fs afero.Fs, path string) (string, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(fs afero.Fs, src string, dst string) error {
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
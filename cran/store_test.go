@@ -0,0 +1,98 @@
+package cran
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unstored is an md5 sum nothing is stored under
+const unstored = "d5e5f5c4a0fb3a3e1b0b5c64a4eb4d6f"
+
+func TestPackageStoreLinksAcrossRepos(t *testing.T) {
+	fs := afero.NewOsFs()
+	baseDir := t.TempDir()
+	store := NewPackageStore(fs, baseDir)
+	cran := filepath.Join(baseDir, "CRAN-abc", "src", "R6_2.5.0.tar.gz")
+	mpn := filepath.Join(baseDir, "MPN-def", "src", "R6_2.5.0.tar.gz")
+	require.NoError(t, fs.MkdirAll(filepath.Dir(cran), 0777))
+	require.NoError(t, afero.WriteFile(fs, cran, []byte("R6"), 0644))
+	sum, err := FileMD5(fs, cran)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(cran, ""))
+	assert.True(t, store.Restore(sum, mpn))
+	fa, err := os.Stat(cran)
+	require.NoError(t, err)
+	fb, err := os.Stat(mpn)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(fa, fb), "the package is kept once")
+	// already present references are left alone
+	assert.False(t, store.Restore(sum, mpn))
+	assert.False(t, store.Restore(unstored, filepath.Join(baseDir, "other", "R6_2.5.0.tar.gz")))
+
+	// stored files are kept while any repo still refers to them
+	require.NoError(t, os.Remove(cran))
+	pruned, err := store.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+	require.NoError(t, os.Remove(mpn))
+	pruned, err = store.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	_, err = os.Stat(store.ObjectPath(sum))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPackageStorePutReplacesCorruptFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	store := NewPackageStore(fs, "/cache")
+	pkg := "/cache/CRAN-abc/src/R6_2.5.0.tar.gz"
+	require.NoError(t, afero.WriteFile(fs, pkg, []byte("R6"), 0644))
+	sum, err := FileMD5(fs, pkg)
+	require.NoError(t, err)
+	require.NoError(t, afero.WriteFile(fs, store.ObjectPath(sum), []byte("corrupt"), 0644))
+
+	require.NoError(t, store.Put(pkg, sum))
+	stored, err := afero.ReadFile(fs, store.ObjectPath(sum))
+	require.NoError(t, err)
+	assert.Equal(t, "R6", string(stored))
+}
+
+func TestDownloadPackagesSharedAcrossRepos(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	baseDir := "/cache"
+	content := []byte("R6 tarball")
+	cran := PkgDl{Package: desc.Desc{Package: "R6", Version: "2.5.0"}, Config: PkgConfig{Repo: RepoURL{Name: "CRAN", URL: "https://cran.invalid"}, Type: Source}}
+	require.NoError(t, afero.WriteFile(fs, packageCachePath(cran, baseDir, RVersion{}, Platform{}), content, 0644))
+	sum, err := FileMD5(fs, packageCachePath(cran, baseDir, RVersion{}, Platform{}))
+	require.NoError(t, err)
+	cran.Package.MD5sum = sum
+	_, err = DownloadPackages(fs, []PkgDl{cran}, baseDir, RVersion{}, Platform{}, false, false, true)
+	require.NoError(t, err)
+
+	// the identical tarball from another repo resolves from the store, even offline
+	mpn := cran
+	mpn.Config.Repo = RepoURL{Name: "MPN", URL: "https://mpn.invalid/2022-06-15"}
+	pkgMap, err := DownloadPackages(fs, []PkgDl{mpn}, baseDir, RVersion{}, Platform{}, false, false, true)
+	require.NoError(t, err)
+	dl, ok := pkgMap.Get("R6")
+	require.True(t, ok)
+	assert.False(t, dl.New)
+	assert.Equal(t, packageCachePath(mpn, baseDir, RVersion{}, Platform{}), dl.Path)
+	actual, err := afero.ReadFile(fs, dl.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+
+	// a different tarball of the same version is not mistaken for it
+	other := mpn
+	other.Config.Repo = RepoURL{Name: "internal", URL: "https://internal.invalid"}
+	other.Package.MD5sum = unstored
+	_, err = DownloadPackages(fs, []PkgDl{other}, baseDir, RVersion{}, Platform{}, false, false, true)
+	assert.Error(t, err)
+}
@@ -1,9 +1,11 @@
 package cran
 
 import (
+	"sync"
 	"time"
 
 	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
 )
 
 // RepoURL represents the URL and name for a repo
@@ -14,21 +16,78 @@ type RepoURL struct {
 	URL    string
 	Name   string
 	Suffix string
+	Auth   RepoAuth
+	TLS    RepoTLS
+	// Group is the name of the configured repo this repo was expanded from,
+	// such as the software repo of a Bioconductor release
+	Group string
+	// BinaryURL is a repo serving binary packages in the src/contrib layout,
+	// rather than under bin/ of URL, eg the __linux__ repos of Posit Package Manager
+	BinaryURL string
+	// UserAgent is sent with requests to the repo when set
+	UserAgent string
+	// Mirrors are urls holding the same content as URL, tried in order
+	// when URL cannot be reached
+	Mirrors []string
+}
+
+// RepoTLS configures the certificates used for https connections to a repo
+type RepoTLS struct {
+	// CACert is a PEM bundle of additional certificate authorities to trust
+	CACert string
+	// ClientCert and ClientKey are a PEM certificate and key for mutual TLS
+	ClientCert string
+	ClientKey  string
+}
+
+// RepoAuth configures how requests to a repo are authenticated. Secrets are only
+// read from the environment or netrc file when a request is made, so never
+// need to be stored in the configuration.
+type RepoAuth struct {
+	// Type is one of basic, bearer or netrc, or empty for no authentication
+	Type        string
+	Username    string
+	PasswordEnv string
+	TokenEnv    string
+	// NetrcFile overrides the default netrc location
+	NetrcFile string
 }
 
 // RepoDb represents a Db
 type RepoDb struct {
-	DescriptionsBySourceType map[SourceType]map[string]desc.Desc
-	Time                     time.Time
-	Repo                     RepoURL
-	DefaultSourceType        SourceType
-	RepoSuffix               string
+	// DescriptionsBySourceType holds every version of each package listed in
+	// the PACKAGES index of each source type, newest first
+	DescriptionsBySourceType map[SourceType]map[string][]desc.Desc
+	// ArchivedDescriptions holds the older versions of packages resolved from
+	// the src/contrib/Archive of the repo, which are always source packages
+	ArchivedDescriptions map[string][]desc.Desc
+	// IndexURLs records the PACKAGES index variant, eg PACKAGES.gz, used for each source type
+	IndexURLs         map[SourceType]string
+	Time              time.Time
+	Repo              RepoURL
+	DefaultSourceType SourceType
+	RepoSuffix        string
+	// Platform is the platform binaries are fetched for
+	Platform         Platform
+	offline          bool
+	archivedVersions map[string][]string
+	// archivedPackages holds the descriptions read from archived tarballs, by <pkg>_<version>,
+	// and archivedDownloads the tarballs downloaded to the package cache not yet kept or discarded
+	archivedPackages  map[string]desc.Desc
+	archivedDownloads map[string]string
+	archiveMutex      sync.Mutex
 }
 
 // InstallConfig contains custom settings for a full install
 type InstallConfig struct {
 	Packages map[string]PkgConfig
 	Repos    map[string]RepoConfig
+	// Offline restricts the package database to the local caches, never querying repos
+	Offline bool
+	// NewerSource chooses source over binary for packages of type Both when the source version is newer
+	NewerSource bool
+	// Platform is the platform to plan for, defaulting to the local platform when unset
+	Platform Platform
 }
 
 // RepoConfig contains settings for a repo
@@ -36,12 +95,21 @@ type RepoConfig struct {
 	DefaultSourceType SourceType
 	RepoType          RepoType
 	RepoSuffix        string
+	// Offline uses the cached repo information regardless of age, never querying the repo
+	Offline bool
+	// Include and Exclude are patterns, such as metrum*, restricting which packages
+	// the repo may provide. Packages must match an Include pattern, if any are
+	// given, and no Exclude pattern
+	Include []string
+	Exclude []string
 }
 
 //PkgConfig stores configuration information about a given package
 type PkgConfig struct {
 	Repo RepoURL
 	Type SourceType
+	// Reason explains the Type chosen for packages of type Both
+	Reason string
 }
 
 // PkgNexus represents a package database
@@ -49,6 +117,32 @@ type PkgNexus struct {
 	Db                []*RepoDb
 	Config            *InstallConfig
 	DefaultSourceType SourceType
+	Constraints       PkgConstraints
+	RVersion          RVersion
+	Platform          Platform
+	NoSecure          bool
+	// PackageCache is the package cache directory on Fs that archived package tarballs,
+	// fetched to read their description, are kept in. They are not kept when unset.
+	PackageCache string
+	Fs           afero.Fs
+}
+
+// PkgConstraint is a version requirement placed on a package
+// along with what imposed it, eg a dependent package
+type PkgConstraint struct {
+	Dep        desc.Dep
+	RequiredBy string
+}
+
+// PkgConstraints holds the version requirements keyed by package name
+type PkgConstraints map[string][]PkgConstraint
+
+// ConstraintError is returned when a package is available, but
+// no available version satisfies all of its version requirements
+type ConstraintError struct {
+	Package     string
+	Constraints []PkgConstraint
+	Available   []string
 }
 
 // Download provides information about the package download
@@ -57,6 +151,8 @@ type Download struct {
 	New      bool
 	Metadata PkgDl
 	Size     int64
+	// Mirror is the repo url or mirror a new download was served by
+	Mirror string
 }
 
 func (d Download) GetMegabytes() float64 {
@@ -0,0 +1,98 @@
+package cran
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	homedir "github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+)
+
+// httpClients caches the client for each tls configuration,
+// so certificates are only loaded once and connections are reused
+var httpClients sync.Map
+
+type clientKey struct {
+	tls      RepoTLS
+	noSecure bool
+}
+
+// Validate checks a client certificate is not given without its key, or vice versa
+func (t RepoTLS) Validate() error {
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("ClientCert and ClientKey must be set together")
+	}
+	return nil
+}
+
+// tlsConfig builds the tls configuration for the repo. A nil config is returned
+// when the repo needs no settings beyond the defaults.
+func (t RepoTLS) tlsConfig(noSecure bool) (*tls.Config, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	if t.CACert == "" && t.ClientCert == "" && !noSecure {
+		return nil, nil
+	}
+	cfg := &tls.Config{}
+	if t.CACert != "" {
+		caPath, _ := homedir.Expand(t.CACert)
+		pem, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CACert: %s", err)
+		}
+		// the CA is added to, rather than replacing, the system pool so that
+		// a repo redirecting to a public CDN still verifies
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CACert %s", caPath)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.ClientCert != "" {
+		certPath, _ := homedir.Expand(t.ClientCert)
+		keyPath, _ := homedir.Expand(t.ClientKey)
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading ClientCert/ClientKey: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if noSecure {
+		// only used as a last resort, as it makes any CACert moot
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// newHTTPClient provides the http client used to query a repository, using
+// the CA bundle and client certificate configured for the repo, if any.
+// noSecure skips validating the certificate chain, see NewPkgDb.
+func newHTTPClient(r RepoURL, noSecure bool) (*http.Client, error) {
+	key := clientKey{r.TLS, noSecure}
+	if client, ok := httpClients.Load(key); ok {
+		return client.(*http.Client), nil
+	}
+	cfg, err := r.TLS.tlsConfig(noSecure)
+	if err != nil {
+		return nil, fmt.Errorf("repo %s: %s", r.Name, err)
+	}
+	client := &http.Client{}
+	if cfg != nil {
+		if noSecure {
+			log.WithField("repo", r.Name).Debug("TLS certificate verification disabled")
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = cfg
+		client = &http.Client{Transport: tr}
+	}
+	actual, _ := httpClients.LoadOrStore(key, client)
+	return actual.(*http.Client), nil
+}
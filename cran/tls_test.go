@@ -0,0 +1,152 @@
+package cran
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert generates a certificate signed by parent, or self signed CA if parent is nil
+func newTestCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestRepoTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "pkgr test CA", nil, 0)
+	serverCert := newTestCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := newTestCert(t, "pkgr", ca, x509.ExtKeyUsageClientAuth)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, ca.certPEM, 0644))
+	certFile := filepath.Join(dir, "client.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, clientCert.certPEM, 0644))
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, ioutil.WriteFile(keyFile, clientCert.keyPEM, 0600))
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Package: pkgA\nVersion: 1.0.0\n"))
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate(t)}}
+	server.StartTLS()
+	defer server.Close()
+	mtlsServer := httptest.NewUnstartedServer(handler)
+	mtlsServer.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    caPool,
+	}
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		tls      RepoTLS
+		noSecure bool
+		ok       bool
+	}{
+		{"untrusted CA", server.URL, RepoTLS{}, false, false},
+		{"CACert", server.URL, RepoTLS{CACert: caFile}, false, true},
+		{"no secure", server.URL, RepoTLS{}, true, true},
+		{"missing client certificate", mtlsServer.URL, RepoTLS{CACert: caFile}, false, false},
+		{"client certificate", mtlsServer.URL, RepoTLS{CACert: caFile, ClientCert: certFile, ClientKey: keyFile}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := RepoURL{Name: "internal", URL: tt.url, TLS: tt.tls}
+			dest := filepath.Join(t.TempDir(), "PACKAGES")
+			_, err := downloadFile(afero.NewOsFs(), repo, tt.url+"/src/contrib/PACKAGES", dest, tt.noSecure)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRepoTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0644))
+	tests := []struct {
+		name string
+		tls  RepoTLS
+		err  string
+	}{
+		{"cert without key", RepoTLS{ClientCert: "client.pem"}, "repo internal: ClientCert and ClientKey must be set together"},
+		{"missing CACert", RepoTLS{CACert: filepath.Join(dir, "missing.pem")}, "repo internal: error reading CACert"},
+		{"invalid CACert", RepoTLS{CACert: notPEM}, "repo internal: no certificates found in CACert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHTTPClient(RepoURL{Name: "internal", TLS: tt.tls}, false)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package cran
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// ErrNotFound signals a file or directory is not present in the repository.
+// Transports return it so missing files can be told apart from failures
+var ErrNotFound = errors.New("not found in repository")
+
+// TransportRequest describes a file to fetch from a repository
+type TransportRequest struct {
+	Repo RepoURL
+	URL  string
+	// NoSecure disables verification of the certificate chain for https
+	NoSecure bool
+	// Offset requests the content from the byte offset, to resume a download
+	Offset int64
+	// ETag and LastModified make the request conditional on the file having
+	// changed since they were returned
+	ETag         string
+	LastModified string
+	// Fs is the file system repos on a local path are read from, the os file system when unset
+	Fs afero.Fs
+}
+
+// localFs provides the file system repos on a local path are read from
+func (req TransportRequest) localFs() afero.Fs {
+	if req.Fs == nil {
+		return afero.NewOsFs()
+	}
+	return req.Fs
+}
+
+// TransportResponse holds the content of a file fetched from a repository
+type TransportResponse struct {
+	Body io.ReadCloser
+	// Offset is the byte offset Body starts from, which is 0 unless the
+	// transport was able to honor the Offset of the request
+	Offset int64
+	// NotModified is set, with no Body, if the request was conditional and
+	// the file has not changed
+	NotModified  bool
+	ETag         string
+	LastModified string
+	// Size is the full size of the file as reported by the server, or 0 if unknown
+	Size int64
+	// MD5sum is the md5 checksum of the file as reported by the server, eg by a
+	// Content-MD5 header, if any. Downloads are checked against Size and MD5sum,
+	// which is the only verification of files missing from the repo index
+	MD5sum string
+}
+
+// Transport fetches the files of repositories for the url schemes it is registered for.
+// Errors implementing Temporary() bool are retried when downloading packages
+type Transport interface {
+	// Fetch fetches the file at the url of the request, returning ErrNotFound if not present
+	Fetch(req TransportRequest) (*TransportResponse, error)
+}
+
+// Lister is implemented by transports able to list the files within a directory,
+// as needed to find the archived versions of a package
+type Lister interface {
+	// List lists the names of the files in the directory at the url of the request,
+	// returning ErrNotFound if the directory is not present
+	List(req TransportRequest) ([]string, error)
+}
+
+var transports = struct {
+	sync.RWMutex
+	schemes map[string]Transport
+}{
+	schemes: map[string]Transport{
+		"http":  httpTransport{},
+		"https": httpTransport{},
+		"file":  fileTransport{},
+		"s3":    s3Transport{},
+	},
+}
+
+// RegisterTransport sets the transport used for repo urls with the scheme, eg "gs" for gs://,
+// replacing any transport already registered for it
+func RegisterTransport(scheme string, t Transport) {
+	transports.Lock()
+	defer transports.Unlock()
+	transports.schemes[strings.ToLower(scheme)] = t
+}
+
+// urlScheme provides the scheme of a url, with urls given as a path being file urls
+func urlScheme(url string) string {
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return "file"
+	}
+	return strings.ToLower(url[:i])
+}
+
+// transportFor provides the transport registered for the scheme of url
+func transportFor(url string) (Transport, error) {
+	scheme := urlScheme(url)
+	transports.RLock()
+	defer transports.RUnlock()
+	t, ok := transports.schemes[scheme]
+	if !ok {
+		return nil, fmt.Errorf("no transport registered for %s:// urls", scheme)
+	}
+	return t, nil
+}
+
+// fetch fetches a file from a repository through the transport for its url
+func fetch(req TransportRequest) (*TransportResponse, error) {
+	t, err := transportFor(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	return t.Fetch(req)
+}
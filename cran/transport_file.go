@@ -0,0 +1,55 @@
+package cran
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/afero"
+)
+
+// fileTransport reads files of repos on the local filesystem, given as a path or file:// url
+type fileTransport struct{}
+
+// localRepoPath converts a repo url for a repo on the local filesystem,
+// which may be given as a path or a file:// url, to an absolute path
+func localRepoPath(url string) string {
+	p, _ := homedir.Expand(strings.TrimPrefix(url, "file://"))
+	p, _ = filepath.Abs(p)
+	return p
+}
+
+func (fileTransport) Fetch(req TransportRequest) (*TransportResponse, error) {
+	f, err := req.localFs().Open(localRepoPath(req.URL))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &TransportResponse{Body: f}
+	if req.Offset > 0 {
+		if _, err := f.Seek(req.Offset, 0); err == nil {
+			res.Offset = req.Offset
+		}
+	}
+	return res, nil
+}
+
+func (fileTransport) List(req TransportRequest) ([]string, error) {
+	var names []string
+	fis, err := afero.ReadDir(req.localFs(), localRepoPath(req.URL))
+	if os.IsNotExist(err) {
+		return names, ErrNotFound
+	}
+	if err != nil {
+		return names, err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,131 @@
+package cran
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// httpTransport fetches files over http(s), authenticating requests and
+// verifying certificates as configured for the repo
+type httpTransport struct{}
+
+func (httpTransport) Fetch(req TransportRequest) (*TransportResponse, error) {
+	hreq, err := newRepoRequest(req.Repo, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if req.Offset > 0 {
+		hreq.Header.Set("Range", fmt.Sprintf("bytes=%d-", req.Offset))
+	}
+	if req.ETag != "" {
+		hreq.Header.Set("If-None-Match", req.ETag)
+	}
+	if req.LastModified != "" {
+		hreq.Header.Set("If-Modified-Since", req.LastModified)
+	}
+	client, err := newHTTPClient(req.Repo, req.NoSecure)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		if isCertificateError(err) {
+			return nil, err
+		}
+		return nil, temporaryError{err}
+	}
+	res := &TransportResponse{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && req.Offset > 0:
+		res.Body = resp.Body
+		res.Offset = req.Offset
+		res.Size = contentRangeSize(resp.Header.Get("Content-Range"))
+		return res, nil
+	case resp.StatusCode == http.StatusOK:
+		res.Body = resp.Body
+		if resp.ContentLength > 0 {
+			res.Size = resp.ContentLength
+		}
+		res.MD5sum = contentMD5(resp.Header.Get("Content-MD5"))
+		return res, nil
+	case resp.StatusCode == http.StatusNotModified && (req.ETag != "" || req.LastModified != ""):
+		resp.Body.Close()
+		res.NotModified = true
+		return res, nil
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && req.Offset > 0:
+		// the partial file does not match the file on the server,
+		// so start over from the beginning
+		resp.Body.Close()
+		req.Offset = 0
+		return httpTransport{}.Fetch(req)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	return nil, &HTTPStatusError{URL: req.URL, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// contentRangeSize provides the full size of the file from a Content-Range header,
+// eg 1000 for bytes 500-999/1000, or 0 if unknown
+func contentRangeSize(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return 0
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// contentMD5 provides the hex md5 sum from a base64 Content-MD5 header, if valid
+func contentMD5(header string) string {
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header))
+	if err != nil || len(sum) != md5.Size {
+		return ""
+	}
+	return hex.EncodeToString(sum)
+}
+
+// hrefRegex matches the links in a html directory index, as served for CRAN-like repos
+var hrefRegex = regexp.MustCompile(`href="([^"?#]+)"`)
+
+// List collects the file names from the links in the html directory index served for the directory
+func (t httpTransport) List(req TransportRequest) ([]string, error) {
+	var names []string
+	req.URL = strings.TrimSuffix(req.URL, "/") + "/"
+	res, err := t.Fetch(req)
+	if err != nil {
+		return names, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return names, err
+	}
+	seen := make(map[string]bool)
+	for _, m := range hrefRegex.FindAllSubmatch(b, -1) {
+		nm := filepath.Base(string(m[1]))
+		if strings.HasSuffix(string(m[1]), "/") || seen[nm] {
+			continue
+		}
+		seen[nm] = true
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	return names, nil
+}
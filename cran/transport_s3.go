@@ -0,0 +1,261 @@
+package cran
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Transport fetches files from S3 and S3-compatible object stores for s3://<bucket>/<key> urls.
+// It is configured with the standard AWS environment variables: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN for credentials, requests being anonymous
+// without them, AWS_REGION or AWS_DEFAULT_REGION, and AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL
+// for S3-compatible stores, which are addressed path style.
+type s3Transport struct{}
+
+// emptyPayloadHash is the SHA256 of the empty body of the GET requests made
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func s3Region() string {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(env); r != "" {
+			return r
+		}
+	}
+	return "us-east-1"
+}
+
+func s3Endpoint() string {
+	for _, env := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if e := os.Getenv(env); e != "" {
+			return strings.TrimSuffix(e, "/")
+		}
+	}
+	return ""
+}
+
+// splitS3URL splits an s3://<bucket>/<key> url into the bucket and key
+func splitS3URL(url string) (string, string) {
+	p := strings.TrimPrefix(url, "s3://")
+	i := strings.Index(p, "/")
+	if i < 0 {
+		return p, ""
+	}
+	return p[:i], p[i+1:]
+}
+
+// s3ObjectURL provides the http(s) url of an object within a bucket
+func s3ObjectURL(bucket string, key string) string {
+	if endpoint := s3Endpoint(); endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", endpoint, bucket, s3EncodePath(key))
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, s3Region(), s3EncodePath(key))
+}
+
+// s3Encode percent encodes all but the unreserved characters, as required when signing requests
+func s3Encode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EncodePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = s3Encode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Query encodes query parameters in the sorted form required when signing requests
+func s3Query(params map[string]string) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, s3Encode(k)+"="+s3Encode(params[k]))
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signS3Request signs a GET request with AWS Signature Version 4,
+// leaving the request anonymous when no credentials are set
+func signS3Request(req *http.Request, now time.Time) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	region := s3Region()
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+		signed = append(signed, "x-amz-security-token")
+	}
+	var headers strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		emptyPayloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(canonicalHash[:]))
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(signed, ";"), hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// s3Do makes a signed request to the http(s) url of a bucket
+func s3Do(req TransportRequest, url string, rawQuery string) (*http.Response, error) {
+	hreq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	hreq.URL.RawQuery = rawQuery
+	if req.Offset > 0 {
+		hreq.Header.Set("Range", fmt.Sprintf("bytes=%d-", req.Offset))
+	}
+	if req.ETag != "" {
+		hreq.Header.Set("If-None-Match", req.ETag)
+	}
+	if req.LastModified != "" {
+		hreq.Header.Set("If-Modified-Since", req.LastModified)
+	}
+	signS3Request(hreq, time.Now())
+	client, err := newHTTPClient(req.Repo, req.NoSecure)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		if isCertificateError(err) {
+			return nil, err
+		}
+		return nil, temporaryError{err}
+	}
+	return resp, nil
+}
+
+func (s3Transport) Fetch(req TransportRequest) (*TransportResponse, error) {
+	bucket, key := splitS3URL(req.URL)
+	resp, err := s3Do(req, s3ObjectURL(bucket, key), "")
+	if err != nil {
+		return nil, err
+	}
+	res := &TransportResponse{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && req.Offset > 0:
+		res.Body = resp.Body
+		res.Offset = req.Offset
+		return res, nil
+	case resp.StatusCode == http.StatusOK:
+		res.Body = resp.Body
+		return res, nil
+	case resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		res.NotModified = true
+		return res, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	return nil, &HTTPStatusError{URL: req.URL, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// s3ListResult is the response to a ListObjectsV2 request
+type s3ListResult struct {
+	Contents []struct {
+		Key string
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List lists the objects directly within the prefix of the url using ListObjectsV2
+func (s3Transport) List(req TransportRequest) ([]string, error) {
+	var names []string
+	bucket, prefix := splitS3URL(strings.TrimSuffix(req.URL, "/") + "/")
+	params := map[string]string{"list-type": "2", "prefix": prefix, "delimiter": "/"}
+	found := false
+	for {
+		resp, err := s3Do(req, s3ObjectURL(bucket, ""), s3Query(params))
+		if err != nil {
+			return names, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusNotFound {
+				return names, ErrNotFound
+			}
+			return names, &HTTPStatusError{URL: req.URL, StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return names, err
+		}
+		for _, c := range result.Contents {
+			names = append(names, path.Base(c.Key))
+		}
+		found = found || len(result.Contents) > 0 || len(result.CommonPrefixes) > 0
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		params["continuation-token"] = result.NextContinuationToken
+	}
+	if !found {
+		return names, ErrNotFound
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,61 @@
+package cran
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memTransport serves files held in memory, keyed by url
+type memTransport map[string]string
+
+func (m memTransport) Fetch(req TransportRequest) (*TransportResponse, error) {
+	content, ok := m[req.URL]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &TransportResponse{Body: ioutil.NopCloser(strings.NewReader(content))}, nil
+}
+
+func TestTransportFor(t *testing.T) {
+	tests := []struct {
+		url       string
+		transport Transport
+	}{
+		{"https://cran.r-project.org/src/contrib/PACKAGES", httpTransport{}},
+		{"HTTP://cran.r-project.org/src/contrib/PACKAGES", httpTransport{}},
+		{"file:///repos/local/src/contrib/PACKAGES", fileTransport{}},
+		{"~/repos/local/src/contrib/PACKAGES", fileTransport{}},
+		{"s3://bucket/repo/src/contrib/PACKAGES", s3Transport{}},
+	}
+	for _, tt := range tests {
+		tr, err := transportFor(tt.url)
+		if assert.NoError(t, err, tt.url) {
+			assert.Equal(t, tt.transport, tr, tt.url)
+		}
+	}
+	_, err := transportFor("gs://bucket/repo")
+	assert.EqualError(t, err, "no transport registered for gs:// urls")
+}
+
+func TestRegisterTransport(t *testing.T) {
+	RegisterTransport("mem", memTransport{
+		"mem://repo/src/contrib/PACKAGES": testPackagesIndex,
+	})
+	defer func() {
+		transports.Lock()
+		delete(transports.schemes, "mem")
+		transports.Unlock()
+	}()
+
+	index, err := fetchPackagesIndex(RepoURL{Name: "mem", URL: "mem://repo"}, "mem://repo/src/contrib", false, indexValidators{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "mem://repo/src/contrib/PACKAGES", index.URL)
+	assert.Equal(t, testPackagesIndex, readTestIndex(t, index))
+
+	_, err = listRepoDir(RepoURL{Name: "mem", URL: "mem://repo"}, "mem://repo/src/contrib/Archive/pkgA", false)
+	assert.EqualError(t, err, "listing directories is not supported for mem:// urls")
+}
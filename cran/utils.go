@@ -9,7 +9,6 @@ import (
 	"io"
 	"io/ioutil"
 	"regexp"
-	"runtime"
 )
 
 type BinaryUriType int
@@ -31,17 +30,14 @@ var supportedDistros = map[string]bool{
 }
 
 // these are also duplicated in rcmd for now
-func binaryName(pkg, version string) string {
-	switch runtime.GOOS {
+func binaryName(pkg, version string, p Platform) string {
+	switch p.OS {
 	case "darwin":
 		return fmt.Sprintf("%s_%s.tgz", pkg, version)
 	case "linux":
-		if osRelease.Id == "rhel" {
-			return fmt.Sprintf("%s_%s_R_x86_64-redhat-linux-gnu.tar.gz", pkg, version)
-		}
 		// checked centos docker container and returned
 		// packaged installation of ‘R6’ as ‘R6_2.5.0_R_x86_64-pc-linux-gnu.tar.gz’
-		return fmt.Sprintf("%s_%s_R_x86_64-pc-linux-gnu.tar.gz", pkg, version)
+		return fmt.Sprintf("%s_%s_R_%s.tar.gz", pkg, version, p)
 	case "windows":
 		return fmt.Sprintf("%s_%s.zip", pkg, version)
 	default:
@@ -51,9 +47,8 @@ func binaryName(pkg, version string) string {
 }
 
 // DefaultType provides the default type for the given platform
-// runtime
-func DefaultType() SourceType {
-	switch runtime.GOOS {
+func DefaultType(p Platform) SourceType {
+	switch p.OS {
 	case "darwin":
 		return Binary
 	case "windows":
@@ -67,14 +62,18 @@ func DefaultType() SourceType {
 
 // SupportsBinary tells if a platform supports binaries
 // namely, windows/mac to, but linux does not
-func SupportsBinary(rt RepoType) bool {
-	switch runtime.GOOS {
+func SupportsBinary(rt RepoType, p Platform) bool {
+	switch p.OS {
 	case "darwin":
 		return true
 	case "windows":
 		return true
 	case "linux":
-		if linuxKnownSupportsBinary() && rt == MPN {
+		if rt == RSPM {
+			// binaries are served from the __linux__ repo for the distribution
+			return rspmLinuxDistro(p) != ""
+		}
+		if linuxKnownSupportsBinary(p) && rt == MPN {
 			return true
 		} else {
 			return false
@@ -86,36 +85,19 @@ func SupportsBinary(rt RepoType) bool {
 
 // linuxKnownSupportsBinary tells if a distro supports binaries
 // namely, Ubuntu 16.04 and 18.04
-func linuxKnownSupportsBinary() bool {
-	err := ReadOsRelease()
-	if err != nil {
-		log.Warnf("error reading linux binary information: %s\n", err)
-		return false
-	}
-	if osRelease.Id == "" {
+func linuxKnownSupportsBinary(p Platform) bool {
+	if p.Distro.Id == "" {
 		return false
 	}
-	if supportedDistros[osRelease.VersionCodename] || supportedDistros[osRelease.Id] {
+	if supportedDistros[p.Distro.VersionCodename] || supportedDistros[p.Distro.Id] {
 		return true
 	}
 	log.Info("The running version of Linux might not support binary packages, please contact the pkgr development team")
 	return true
 }
 
-func getLinuxCodename() string {
-	ReadOsRelease()
-	return osRelease.VersionCodename
-}
-
-
-func getLinuxBinaryUri() string {
-	if !osRelease.checked {
-		err := ReadOsRelease()
-		if err != nil {
-			log.Warnf("could not get derive linux information with error: %s\n", err)
-			return ""
-		}
-	}
+func getLinuxBinaryUri(p Platform) string {
+	osRelease := p.Distro
 	if osRelease.Id == "" {
 		return ""
 	}
@@ -139,8 +121,10 @@ func getLinuxBinaryUri() string {
 	return fmt.Sprintf("%s/%s", osRelease.Id, osRelease.VersionId)
 }
 
-func cranBinaryURL(rv RVersion) string {
-	switch runtime.GOOS {
+// cranBinaryURL provides the directory under bin/ of a repo the binaries
+// for the R version and platform are served from
+func cranBinaryURL(rv RVersion, p Platform) string {
+	switch p.OS {
 	case "darwin":
 		if rv.Major == 4 {
 			return "macosx"
@@ -149,7 +133,7 @@ func cranBinaryURL(rv RVersion) string {
 	case "windows":
 		return "windows"
 	case "linux":
-		return fmt.Sprintf("linux/%s", getLinuxBinaryUri())
+		return fmt.Sprintf("linux/%s", getLinuxBinaryUri(p))
 	default:
 		fmt.Println("platform not supported for binary detection")
 		return ""
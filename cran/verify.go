@@ -0,0 +1,77 @@
+package cran
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+)
+
+// ChecksumError is returned when a downloaded package does not
+// match the checksum published in the repository index
+type ChecksumError struct {
+	Package   string
+	Path      string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch for package %s (%s): expected %s, got %s",
+		e.Algorithm, e.Package, e.Path, e.Expected, e.Actual)
+}
+
+// verifyChecksums checks a downloaded package file against the MD5sum and SHA256
+// checksums of the package description. Checksums not published by the repo are skipped.
+func verifyChecksums(fs afero.Fs, path string, d desc.Desc) error {
+	expected := map[string]string{}
+	hashes := map[string]hash.Hash{}
+	if d.MD5sum != "" {
+		expected["MD5sum"] = d.MD5sum
+		hashes["MD5sum"] = md5.New()
+	}
+	if d.SHA256 != "" {
+		expected["SHA256"] = d.SHA256
+		hashes["SHA256"] = sha256.New()
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	f, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var writers []io.Writer
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return err
+	}
+	// check in a fixed order so the error reported is deterministic
+	for _, alg := range []string{"MD5sum", "SHA256"} {
+		h, ok := hashes[alg]
+		if !ok {
+			continue
+		}
+		actual := hex.EncodeToString(h.Sum(nil))
+		if !strings.EqualFold(actual, strings.TrimSpace(expected[alg])) {
+			return &ChecksumError{
+				Package:   d.Package,
+				Path:      path,
+				Algorithm: alg,
+				Expected:  expected[alg],
+				Actual:    actual,
+			}
+		}
+	}
+	return nil
+}
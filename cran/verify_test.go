@@ -0,0 +1,80 @@
+package cran
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/pkgA_1.0.0.tar.gz", []byte("pkgA"), 0644))
+	// checksums of "pkgA"
+	md5sum := "100337ce3e6093509b51d42bee28b373"
+	sha := "d341065450986f90728238b64a427481c5e3d7bfb19028a9f4d4749a2493c238"
+	tests := []struct {
+		name      string
+		pkg       desc.Desc
+		algorithm string
+	}{
+		{"no checksums published", desc.Desc{Package: "pkgA"}, ""},
+		{"matching md5", desc.Desc{Package: "pkgA", MD5sum: md5sum}, ""},
+		{"matching md5 and sha256", desc.Desc{Package: "pkgA", MD5sum: md5sum, SHA256: sha}, ""},
+		{"matching uppercase sha256", desc.Desc{Package: "pkgA", SHA256: "D341065450986F90728238B64A427481C5E3D7BFB19028A9F4D4749A2493C238"}, ""},
+		{"mismatched md5", desc.Desc{Package: "pkgA", MD5sum: "00000000000000000000000000000000", SHA256: sha}, "MD5sum"},
+		{"mismatched sha256", desc.Desc{Package: "pkgA", MD5sum: md5sum, SHA256: md5sum}, "SHA256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyChecksums(fs, "/pkgA_1.0.0.tar.gz", tt.pkg)
+			if tt.algorithm == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.IsType(t, &ChecksumError{}, err) {
+				assert.Equal(t, tt.algorithm, err.(*ChecksumError).Algorithm)
+			}
+		})
+	}
+}
+
+func TestDownloadPackageChecksumMismatch(t *testing.T) {
+	dir := newTestArchiveRepo(t)
+	defer os.RemoveAll(dir)
+	dest, err := ioutil.TempDir("", "pkgr-verify-dl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dest)
+	fs := afero.NewOsFs()
+	pkgFile := filepath.Join(dest, "pkgA_2.0.0.tar.gz")
+	d := PkgDl{
+		Package: desc.Desc{Package: "pkgA", Version: "2.0.0", MD5sum: "00000000000000000000000000000000"},
+		Config:  PkgConfig{Repo: RepoURL{Name: "local", URL: dir}, Type: Source},
+	}
+
+	_, err = DownloadPackage(fs, d, pkgFile, RVersion{}, Platform{}, false, false, false)
+	assert.IsType(t, &ChecksumError{}, err)
+	exists, _ := afero.Exists(fs, pkgFile)
+	assert.False(t, exists, "tarball failing verification should be removed")
+
+	dl, err := DownloadPackage(fs, d, pkgFile, RVersion{}, Platform{}, false, true, false)
+	assert.NoError(t, err)
+	assert.True(t, dl.New)
+
+	// a bad tarball already in the cache is downloaded again
+	b, err := ioutil.ReadFile(filepath.Join(dir, "src", "contrib", "pkgA_2.0.0.tar.gz"))
+	require.NoError(t, err)
+	d.Package.MD5sum = fmt.Sprintf("%x", md5.Sum(b))
+	require.NoError(t, ioutil.WriteFile(pkgFile, []byte("truncated"), 0644))
+	dl, err = DownloadPackage(fs, d, pkgFile, RVersion{}, Platform{}, false, false, false)
+	assert.NoError(t, err)
+	assert.True(t, dl.New)
+	assert.NoError(t, verifyChecksums(fs, pkgFile, d.Package))
+}
@@ -0,0 +1,131 @@
+package cran
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+)
+
+// addDescription adds a version of a package to descriptions, keeping the
+// versions of each package ordered newest first. Versions listed more than once,
+// eg builds for different R versions, are kept in the order they were added.
+func addDescription(descriptions map[string][]desc.Desc, d desc.Desc) {
+	ds := append(descriptions[d.Package], d)
+	sort.SliceStable(ds, func(i, j int) bool {
+		return desc.CompareVersionStrings(ds[i].Version, ds[j].Version) > 0
+	})
+	descriptions[d.Package] = ds
+}
+
+// pathRVersionRegex matches the Path of packages published for a specific
+// R version, eg 4.1.0/Recommended
+var pathRVersionRegex = regexp.MustCompile(`^(\d+)\.(\d+)\.\d+(/|$)`)
+
+// isRCompatible checks a package version can be installed with the R version of
+// the package database, which is assumed when the R version is not known.
+// Packages with a Path for a specific R version are only compatible with
+// that minor version of R
+func (pkgNexus *PkgNexus) isRCompatible(d desc.Desc) bool {
+	if pkgNexus.RVersion == (RVersion{}) {
+		return true
+	}
+	if m := pathRVersionRegex.FindStringSubmatch(strings.Trim(d.Path, "/")); m != nil {
+		if m[1] != strconv.Itoa(pkgNexus.RVersion.Major) || m[2] != strconv.Itoa(pkgNexus.RVersion.Minor) {
+			return false
+		}
+	}
+	_, ok := isRVersionCompatible(d, pkgNexus.RVersion)
+	return ok
+}
+
+// selectVersion picks the highest version of a package from the newest first ds
+// that is compatible with the R version and satisfies any version constraints.
+// Versions in a subdirectory of the repo, given by their Path, are only used
+// when none of the versions at the top level fit
+func (pkgNexus *PkgNexus) selectVersion(ds []desc.Desc) (desc.Desc, bool) {
+	for _, inSubdir := range []bool{false, true} {
+		for _, d := range ds {
+			if (d.Path != "") != inSubdir {
+				continue
+			}
+			if pkgNexus.isRCompatible(d) && pkgNexus.Constraints.IsSatisfiedBy(d) {
+				return d, true
+			}
+		}
+	}
+	return desc.Desc{}, false
+}
+
+// describeVersion describes a version of a package in the form <version> (<repo>, <kind>),
+// noting the R version required when incompatible with the R version of the package database
+func (pkgNexus *PkgNexus) describeVersion(d desc.Desc, repo string, kind string) string {
+	if d.Path != "" && kind != "archive" {
+		kind += ", " + strings.Trim(d.Path, "/")
+	}
+	if !pkgNexus.isRCompatible(d) {
+		if _, ok := d.Depends["R"]; ok {
+			return fmt.Sprintf("%s (%s, %s, requires %s)", d.Version, repo, kind, d.Depends["R"].ToString())
+		}
+		return fmt.Sprintf("%s (%s, %s, for another R version)", d.Version, repo, kind)
+	}
+	return fmt.Sprintf("%s (%s, %s)", d.Version, repo, kind)
+}
+
+// RVersionDowngrade describes the newest version of a package passed over in favor of d
+// as it requires a newer version of R, returning false when no newer version was passed over
+func (pkgNexus *PkgNexus) RVersionDowngrade(pkg string, d desc.Desc) (string, bool) {
+	if d.Version == "" {
+		return "", false
+	}
+	return pkgNexus.newestRequiringNewerR(pkg, d.Version)
+}
+
+// NeedsNewerR reports whether a package is only missing from the package database
+// because every version listed requires a newer version of R, in which case an
+// older version may be found in the repo archives
+func (pkgNexus *PkgNexus) NeedsNewerR(pkg string) bool {
+	if _, _, ok := pkgNexus.GetPackage(pkg); ok {
+		return false
+	}
+	_, ok := pkgNexus.newestRequiringNewerR(pkg, "")
+	return ok
+}
+
+// newestRequiringNewerR describes the newest version of a package newer than the version,
+// if given, that satisfies its constraints but requires a newer version of R
+func (pkgNexus *PkgNexus) newestRequiringNewerR(pkg string, than string) (string, bool) {
+	newest := ""
+	description := ""
+	for _, db := range pkgNexus.Db {
+		if !isCorrectRepo(pkg, db.Repo, pkgNexus.Config.Packages) || !pkgNexus.repoAllows(db.Repo, pkg) {
+			continue
+		}
+		for _, st := range []SourceType{Source, Binary} {
+			for _, e := range db.DescriptionsBySourceType[st][pkg] {
+				if !pkgNexus.requiresNewerR(e) || !pkgNexus.Constraints.IsSatisfiedBy(e) ||
+					(than != "" && desc.CompareVersionStrings(e.Version, than) <= 0) {
+					continue
+				}
+				if newest == "" || desc.CompareVersionStrings(e.Version, newest) > 0 {
+					newest = e.Version
+					description = pkgNexus.describeVersion(e, db.Repo.Name, st.String())
+				}
+			}
+		}
+	}
+	return description, description != ""
+}
+
+// requiresNewerR reports whether the R version requirement of a package is not met,
+// which a package published for another R version, by its Path, does not count towards
+func (pkgNexus *PkgNexus) requiresNewerR(d desc.Desc) bool {
+	if pkgNexus.RVersion == (RVersion{}) {
+		return false
+	}
+	_, ok := isRVersionCompatible(d, pkgNexus.RVersion)
+	return !ok
+}
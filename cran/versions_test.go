@@ -0,0 +1,156 @@
+package cran
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddDescription(t *testing.T) {
+	descriptions := make(map[string][]desc.Desc)
+	for _, v := range []string{"1.0.0", "1.10.0", "1.2.0", "1.2.0"} {
+		addDescription(descriptions, desc.Desc{Package: "pkgA", Version: v})
+	}
+	var versions []string
+	for _, d := range descriptions["pkgA"] {
+		versions = append(versions, d.Version)
+	}
+	assert.Equal(t, []string{"1.10.0", "1.2.0", "1.2.0", "1.0.0"}, versions)
+}
+
+func TestFetchPackagesMultipleVersions(t *testing.T) {
+	os.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	dir := t.TempDir()
+	contrib := filepath.Join(dir, "src", "contrib")
+	require.NoError(t, os.MkdirAll(contrib, 0755))
+	packages := "Package: pkgA\nVersion: 1.0.0\n\n" +
+		"Package: pkgA\nVersion: 3.0.0\nDepends: R (>= 4.2.0)\n\n" +
+		"Package: pkgA\nVersion: 2.0.0\nDepends: R (>= 4.0.0)\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(contrib, "PACKAGES"), []byte(packages), 0644))
+
+	rv := RVersion{Major: 4, Minor: 1, Patch: 2}
+	db := &RepoDb{
+		DescriptionsBySourceType: map[SourceType]map[string][]desc.Desc{Source: {}},
+		Repo:                     RepoURL{Name: "internal", URL: dir},
+		DefaultSourceType:        Source,
+	}
+	require.NoError(t, db.FetchPackages(rv, false))
+	require.Len(t, db.DescriptionsBySourceType[Source]["pkgA"], 3)
+
+	pkgNexus := newTestNexus(db)
+	pkgNexus.RVersion = rv
+	// the newest version requires a newer R
+	d, _, ok := pkgNexus.GetPackage("pkgA")
+	assert.True(t, ok)
+	assert.Equal(t, "2.0.0", d.Version)
+
+	pkgNexus.AddConstraint(desc.ParseDep("pkgA (< 2.0.0)"), "pkgB")
+	d, _, ok = pkgNexus.GetPackage("pkgA")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", d.Version)
+	d, _, ok = pkgNexus.GetPackageFromRepo("pkgA", "internal")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", d.Version)
+
+	assert.Equal(t, map[string][]string{
+		"internal": {
+			"3.0.0 (internal, source, requires R (>= 4.2.0))",
+			"2.0.0 (internal, source)",
+			"1.0.0 (internal, source)",
+		},
+	}, pkgNexus.GetVersionsByRepo("pkgA"))
+	assert.Empty(t, pkgNexus.GetVersionsByRepo("pkgB"))
+}
+
+func TestPackagesWithPath(t *testing.T) {
+	rv := RVersion{Major: 4, Minor: 1, Patch: 2}
+	db := newTestRepoDb(RepoURL{Name: "CRAN"},
+		desc.Desc{Package: "pkgA", Version: "2.0.0", Depends: map[string]desc.Dep{"R": desc.ParseDep("R (>= 4.2.0)")}},
+		desc.Desc{Package: "pkgA", Version: "1.9.0", Path: "4.0.0/Recommended"},
+		desc.Desc{Package: "pkgA", Version: "1.5.0", Path: "4.1.0/Recommended"},
+		desc.Desc{Package: "pkgA", Version: "1.0.0", Path: "older"},
+		desc.Desc{Package: "pkgB", Version: "1.0.0"},
+		desc.Desc{Package: "pkgB", Version: "1.1.0", Path: "4.1.0/Recommended"},
+	)
+	pkgNexus := newTestNexus(db)
+	pkgNexus.RVersion = rv
+	// packages in a subdirectory are only used when no other version fits,
+	// and only for the R version they were published for
+	d, _, ok := pkgNexus.GetPackage("pkgA")
+	assert.True(t, ok)
+	assert.Equal(t, "1.5.0", d.Version)
+	assert.Equal(t, "4.1.0/Recommended", d.Path)
+
+	d, _, ok = pkgNexus.GetPackage("pkgB")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", d.Version)
+
+	pkgNexus.AddConstraint(desc.ParseDep("pkgA (< 1.5.0)"), "pkgC")
+	d, _, ok = pkgNexus.GetPackage("pkgA")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0", d.Version)
+	assert.Equal(t, "older", d.Path)
+
+	assert.Equal(t, []string{
+		"2.0.0 (CRAN, source, requires R (>= 4.2.0))",
+		"1.9.0 (CRAN, source, 4.0.0/Recommended, for another R version)",
+		"1.5.0 (CRAN, source, 4.1.0/Recommended)",
+		"1.0.0 (CRAN, source, older)",
+	}, pkgNexus.GetAvailableVersions("pkgA"))
+}
+
+func TestPackageURLWithPath(t *testing.T) {
+	r := RepoURL{Name: "CRAN", URL: "https://cran.r-project.org/"}
+	assert.Equal(t, "https://cran.r-project.org/src/contrib/4.1.0/Recommended/Matrix_1.4-0.tar.gz",
+		sourcePackageURL(r, "4.1.0/Recommended", "Matrix_1.4-0.tar.gz"))
+	rv := RVersion{Major: 4, Minor: 1}
+	p := Platform{OS: "darwin", Arch: "x86_64", Vendor: "apple"}
+	assert.Equal(t, "https://cran.r-project.org/bin/macosx/contrib/4.1/older/pkgA_1.0.0.tgz",
+		binaryPackageURL(r, rv, p, "older/", "pkgA_1.0.0.tgz"))
+	r.Suffix = "focal"
+	assert.Equal(t, "https://cran.r-project.org/bin/macosx/focal/contrib/4.1/pkgA_1.0.0.tgz",
+		binaryPackageURL(r, rv, p, "", "pkgA_1.0.0.tgz"))
+}
+
+func TestRVersionDowngrade(t *testing.T) {
+	requiresR := func(pkg string, version string, r string) desc.Desc {
+		return desc.Desc{Package: pkg, Version: version, Depends: map[string]desc.Dep{"R": desc.ParseDep("R (>= " + r + ")")}}
+	}
+	db := newTestRepoDb(RepoURL{Name: "CRAN", URL: "https://cran.r-project.org"},
+		desc.Desc{Package: "pkgA", Version: "1.0.0"},
+		requiresR("pkgA", "2.0.0", "4.2.0"),
+		requiresR("pkgA", "3.0.0", "4.3.0"),
+		desc.Desc{Package: "pkgB", Version: "1.0.0"},
+		requiresR("pkgC", "1.0.0", "4.2.0"),
+	)
+	pkgNexus := newTestNexus(db)
+	pkgNexus.RVersion = RVersion{Major: 4, Minor: 1, Patch: 2}
+
+	d, _, ok := pkgNexus.GetPackage("pkgA")
+	require.True(t, ok)
+	assert.Equal(t, "1.0.0", d.Version)
+	newer, ok := pkgNexus.RVersionDowngrade("pkgA", d)
+	assert.True(t, ok)
+	assert.Equal(t, "3.0.0 (CRAN, source, requires R (>= 4.3.0))", newer)
+
+	// newer versions excluded by constraints are not a downgrade due to the R version
+	pkgNexus.AddConstraint(desc.ParseDep("pkgA (< 3.0.0)"), "pkgD")
+	newer, ok = pkgNexus.RVersionDowngrade("pkgA", d)
+	assert.True(t, ok)
+	assert.Equal(t, "2.0.0 (CRAN, source, requires R (>= 4.2.0))", newer)
+
+	d, _, ok = pkgNexus.GetPackage("pkgB")
+	require.True(t, ok)
+	_, ok = pkgNexus.RVersionDowngrade("pkgB", d)
+	assert.False(t, ok)
+
+	assert.True(t, pkgNexus.NeedsNewerR("pkgC"))
+	assert.False(t, pkgNexus.NeedsNewerR("pkgA"))
+	assert.False(t, pkgNexus.NeedsNewerR("missing"))
+}
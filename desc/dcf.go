@@ -0,0 +1,283 @@
+package desc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DCFReader reads the paragraphs of a Debian Control File, such as a PACKAGES
+// index, one at a time rather than reading the whole file into memory
+type DCFReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewDCFReader returns a DCFReader reading from r
+func NewDCFReader(r io.Reader) *DCFReader {
+	return &DCFReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Paragraph is the text of a single paragraph of a DCF file,
+// along with the line of the file it starts on
+type Paragraph struct {
+	Text string
+	Line int
+}
+
+// Next provides the next paragraph, skipping the blank lines separating
+// paragraphs, returning io.EOF once every paragraph has been read
+func (d *DCFReader) Next() (Paragraph, error) {
+	var b strings.Builder
+	p := Paragraph{}
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return p, err
+		}
+		if line == "" && err == io.EOF {
+			if b.Len() > 0 {
+				p.Text = b.String()
+				return p, nil
+			}
+			return p, io.EOF
+		}
+		d.line++
+		if line == "\n" || line == "\r\n" {
+			if b.Len() > 0 {
+				p.Text = b.String()
+				return p, nil
+			}
+			continue
+		}
+		if b.Len() == 0 {
+			p.Line = d.line
+		}
+		b.WriteString(line)
+		if err == io.EOF {
+			p.Text = b.String()
+			return p, nil
+		}
+	}
+}
+
+// ParseFields parses the fields of a paragraph, following the same rules as
+// pault.ag/go/debian/control, so continuation lines are joined by newlines
+// with the leading space removed, and a continuation line of only . is empty.
+// Parsing stops at the first blank line.
+func ParseFields(paragraph string) (map[string]string, error) {
+	fields := make(map[string]string)
+	var lastKey string
+	for len(paragraph) > 0 {
+		var line string
+		if i := strings.IndexByte(paragraph, '\n'); i >= 0 {
+			line, paragraph = paragraph[:i+1], paragraph[i+1:]
+		} else {
+			line, paragraph = paragraph, ""
+		}
+		if line == "\n" || line == "\r\n" {
+			// the paragraph ends at the first blank line
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			line = strings.TrimRightFunc(line[1:], unicode.IsSpace)
+			if line == "." {
+				line = ""
+			}
+			value := fields[lastKey]
+			if value != "" && !strings.HasSuffix(value, "\n") {
+				value += "\n"
+			}
+			fields[lastKey] = value + line + "\n"
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return fields, fmt.Errorf("Bad line: '%s' has no ':'", line)
+		}
+		lastKey = strings.TrimSpace(line[:i])
+		fields[lastKey] = strings.TrimSpace(line[i+1:])
+	}
+	return fields, nil
+}
+
+// ParseParagraph parses a package description from a single paragraph,
+// giving the same result as ParseDesc without the cost of reflection
+func ParseParagraph(paragraph string) (Desc, error) {
+	var dsc desc
+	fields, err := ParseFields(paragraph)
+	if err != nil {
+		return NewDesc(dsc), err
+	}
+	for k, v := range fields {
+		switch k {
+		case "Package":
+			dsc.Package = v
+		case "Source":
+			dsc.Source = v
+		case "Version":
+			dsc.Version = v
+		case "Maintainer":
+			dsc.Maintainer = v
+		case "Description":
+			dsc.Description = v
+		case "License":
+			dsc.License = v
+		case "MD5sum":
+			dsc.MD5sum = v
+		case "SHA256":
+			dsc.SHA256 = v
+		case "NeedsCompilation":
+			dsc.NeedsCompilation = v
+		case "Path":
+			dsc.Path = v
+		case "Priority":
+			dsc.Priority = v
+		case "Remotes":
+			dsc.Remotes = splitList(v)
+		case "OriginalRepository":
+			dsc.OriginalRepository = v
+		case "Repository":
+			dsc.Repository = v
+		case "Imports":
+			dsc.Imports = splitList(v)
+		case "Suggests":
+			dsc.Suggests = splitList(v)
+		case "Depends":
+			dsc.Depends = splitList(v)
+		case "LinkingTo":
+			dsc.LinkingTo = splitList(v)
+		case "PkgrVersion":
+			dsc.PkgrVersion = v
+		case "PkgrInstallType":
+			dsc.PkgrInstallType = v
+		case "PkgrRepositoryURL":
+			dsc.PkgrRepositoryURL = v
+		}
+	}
+	return NewDesc(dsc), nil
+}
+
+// listCutset is the strip tag of the list fields of desc
+const listCutset = "\n\r\t "
+
+// splitList splits a comma separated field as tagged on the list fields of desc
+func splitList(v string) []string {
+	parts := strings.Split(strings.Trim(v, listCutset), ",")
+	for i, p := range parts {
+		parts[i] = strings.Trim(p, listCutset)
+	}
+	return parts
+}
+
+// dcfBatchSize is the number of paragraphs parsed together by a worker
+const dcfBatchSize = 256
+
+type dcfBatch struct {
+	paragraphs []Paragraph
+	descs      []Desc
+	err        error
+	done       chan struct{}
+}
+
+func (b *dcfBatch) parse() {
+	defer close(b.done)
+	b.descs = make([]Desc, len(b.paragraphs))
+	for i, p := range b.paragraphs {
+		d, err := ParseParagraph(p.Text)
+		if err != nil {
+			b.err = fmt.Errorf("line %d: %s", p.Line, err)
+			return
+		}
+		b.descs[i] = d
+	}
+}
+
+// ParseDescs parses every paragraph of a DCF file, such as a PACKAGES index, as it
+// is read, across the given number of workers. fn is called with each description
+// in the order they appear in the file. Parsing stops at the first error, which is
+// returned without waiting for the rest of r to be read.
+func ParseDescs(r io.Reader, workers int, fn func(Desc)) error {
+	if workers < 1 {
+		workers = 1
+	}
+	dcf := NewDCFReader(r)
+	jobs := make(chan *dcfBatch)
+	// batches are queued in order as well as handed to the workers,
+	// so the results can be passed to fn in order
+	ordered := make(chan *dcfBatch, workers*2)
+	stop := make(chan struct{})
+	var readErr error
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for {
+			b := &dcfBatch{done: make(chan struct{})}
+			for len(b.paragraphs) < dcfBatchSize {
+				p, err := dcf.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					readErr = err
+					break
+				}
+				b.paragraphs = append(b.paragraphs, p)
+			}
+			if len(b.paragraphs) == 0 {
+				return
+			}
+			select {
+			case ordered <- b:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- b:
+			case <-stop:
+				return
+			}
+			if readErr != nil || len(b.paragraphs) < dcfBatchSize {
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case b, ok := <-jobs:
+					if !ok {
+						return
+					}
+					b.parse()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	// only the workers are waited on, as the reader may be blocked reading r
+	// until it is closed, such as a stalled response body
+	defer wg.Wait()
+	for b := range ordered {
+		<-b.done
+		if b.err != nil {
+			close(stop)
+			return b.err
+		}
+		for _, d := range b.descs {
+			fn(d)
+		}
+	}
+	return readErr
+}
@@ -0,0 +1,203 @@
+package desc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseSplit parses a PACKAGES index as FetchPackages did prior to ParseDescs,
+// splitting it into paragraphs in memory and parsing each with ParseDesc
+func parseSplit(body []byte) ([]Desc, error) {
+	var descs []Desc
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	for _, pkg := range bytes.Split(body, []byte("\n\n")) {
+		if len(pkg) == 0 {
+			continue
+		}
+		d, err := ParseDesc(bytes.NewReader(pkg))
+		if err != nil {
+			return descs, err
+		}
+		descs = append(descs, d)
+	}
+	return descs, nil
+}
+
+func parseDescs(body []byte, workers int) ([]Desc, error) {
+	var descs []Desc
+	err := ParseDescs(bytes.NewReader(body), workers, func(d Desc) {
+		descs = append(descs, d)
+	})
+	return descs, err
+}
+
+// cranPackages generates a PACKAGES index of n packages laid out
+// as tools::write_PACKAGES does for CRAN, wrapping long fields
+func cranPackages(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	deps := func(max int) string {
+		var ds []string
+		for i := rng.Intn(max); i > 0; i-- {
+			d := fmt.Sprintf("pkg%d", rng.Intn(n))
+			if rng.Intn(2) == 0 {
+				d += fmt.Sprintf(" (>= %d.%d.%d)", rng.Intn(3), rng.Intn(10), rng.Intn(10))
+			}
+			ds = append(ds, d)
+		}
+		return strings.Join(ds, ", ")
+	}
+	field := func(name string, value string) {
+		if value == "" {
+			return
+		}
+		line := name + ":"
+		for _, word := range strings.Split(value, " ") {
+			if len(line)+len(word) > 72 {
+				b.WriteString(line + "\n")
+				line = "       "
+			}
+			line += " " + word
+		}
+		b.WriteString(line + "\n")
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		field("Package", fmt.Sprintf("pkg%d", i))
+		field("Version", fmt.Sprintf("%d.%d-%d", rng.Intn(3), rng.Intn(20), rng.Intn(5)))
+		field("Depends", strings.TrimPrefix("R (>= 3.5.0), "+deps(3), ", "))
+		field("Imports", deps(12))
+		field("LinkingTo", deps(3))
+		field("Suggests", deps(10))
+		field("License", "GPL-2 | GPL-3")
+		field("MD5sum", fmt.Sprintf("%016x%016x", rng.Uint64(), rng.Uint64()))
+		field("NeedsCompilation", []string{"no", "yes"}[rng.Intn(2)])
+	}
+	return []byte(b.String())
+}
+
+func TestParseDescsMatchesParseDesc(t *testing.T) {
+	files, err := filepath.Glob("../localrepos/*/src/contrib/PACKAGES")
+	require.NoError(t, err)
+	more, err := filepath.Glob("../integration_tests/*/src/contrib/PACKAGES")
+	require.NoError(t, err)
+	files = append(files, more...)
+	require.NotEmpty(t, files)
+	fixtures := map[string][]byte{"generated": cranPackages(2000)}
+	for _, f := range append(files, "testdata/D1", "testdata/D2", "testdata/dplyr.source", "testdata/dplyr.macbinary") {
+		body, err := ioutil.ReadFile(f)
+		require.NoError(t, err)
+		fixtures[f] = body
+	}
+	fixtures["edge cases"] = []byte("# comment\nPackage: pkgA\nVersion: 1.0.0\nImports:\nDescription: first\n .\n  indented\r\n\r\n" +
+		"Package: pkgB\nVersion: 1.0.0\nVersion: 2.0.0\nSuggests: pkgA,\n\tpkgC (>= 1.0)\nRemotes: a/b, c/d\nPriority: recommended\nPath: older")
+
+	for name, body := range fixtures {
+		expected, err := parseSplit(body)
+		require.NoError(t, err, name)
+		for _, workers := range []int{1, 4} {
+			actual, err := parseDescs(body, workers)
+			require.NoError(t, err, name)
+			assert.Equal(t, expected, actual, name)
+		}
+	}
+}
+
+func TestParseDescsError(t *testing.T) {
+	body := append(cranPackages(600), []byte("\n\nPackage: pkgBad\nnot a field\n")...)
+	count := 0
+	err := ParseDescs(bytes.NewReader(body), 2, func(Desc) { count++ })
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "has no ':'")
+	}
+	// only the descriptions ahead of the bad batch are provided
+	assert.Equal(t, 512, count)
+}
+
+func TestParseDescsErrorStalledReader(t *testing.T) {
+	// the body stalls once written, as a network response might,
+	// so the error must be returned without reading it to the end
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write(append([]byte("Package: pkgBad\nnot a field\n\n"), cranPackages(600)...))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- ParseDescs(pr, 2, func(Desc) {})
+	}()
+	select {
+	case err := <-errs:
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "has no ':'")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ParseDescs did not return after a parse error")
+	}
+}
+
+func TestDCFReader(t *testing.T) {
+	r := NewDCFReader(strings.NewReader("\n\nPackage: pkgA\n\n\n\nPackage: pkgB\n Continued\n"))
+	p, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, Paragraph{Text: "Package: pkgA\n", Line: 3}, p)
+	p, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, Paragraph{Text: "Package: pkgB\n Continued\n", Line: 7}, p)
+	_, err = r.Next()
+	assert.Error(t, err)
+}
+
+// benchmarkPackages provides the PACKAGES index benchmarked, a generated index the size of
+// CRAN's unless PKGR_BENCH_PACKAGES is the path to a real one, eg
+// curl -o PACKAGES https://cloud.r-project.org/src/contrib/PACKAGES
+func benchmarkPackages(b *testing.B) []byte {
+	if f := os.Getenv("PKGR_BENCH_PACKAGES"); f != "" {
+		body, err := ioutil.ReadFile(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return body
+	}
+	return cranPackages(20000)
+}
+
+// BenchmarkParsePackages compares ParseDescs against splitting the index
+// in memory and parsing each entry with ParseDesc, as was done before it
+func BenchmarkParsePackages(b *testing.B) {
+	body := benchmarkPackages(b)
+	b.Run("split", func(b *testing.B) {
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := parseSplit(body); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	workers := []int{1}
+	if runtime.NumCPU() > 1 {
+		workers = append(workers, runtime.NumCPU())
+	}
+	for _, workers := range workers {
+		b.Run(fmt.Sprintf("ParseDescs/workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				if _, err := parseDescs(body, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
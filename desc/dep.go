@@ -9,4 +9,21 @@ func (d Dep) ToString() string {
 	return fmt.Sprintf("%s (%s %s)", d.Name, d.Constraint.ToString(), d.Version.String)
 }
 
-// R (>= 3.6)
+// IsSatisfiedBy checks whether the version fulfills the constraint of the dep.
+// A dep without a constraint, eg Imports: dplyr, is satisfied by any version
+func (d Dep) IsSatisfiedBy(v Version) bool {
+	switch d.Constraint {
+	case GT:
+		return CompareVersions(v, d.Version) > 0
+	case GTE:
+		return CompareVersions(v, d.Version) >= 0
+	case LT:
+		return CompareVersions(v, d.Version) < 0
+	case LTE:
+		return CompareVersions(v, d.Version) <= 0
+	case Equals:
+		return CompareVersions(v, d.Version) == 0
+	default:
+		return true
+	}
+}
@@ -1,6 +1,7 @@
 package desc
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/suite"
 	"testing"
 )
@@ -110,3 +111,32 @@ func (suite *DepTestSuite) TestDepToString_VersionContainsDev() {
 
 	suite.Equal(expected, actual)
 }
+
+func (suite *DepTestSuite) TestDepIsSatisfiedBy() {
+	var data = []struct {
+		constraint Constraint
+		version    string
+		expected   bool
+	}{
+		{None, "0.0.1", true},
+		{GT, "2.3.1", false},
+		{GT, "2.3.2", true},
+		{GTE, "2.3.1", true},
+		{GTE, "2.3.0", false},
+		{LT, "2.3.1", false},
+		{LT, "2.2.9", true},
+		{LTE, "2.3.1", true},
+		{LTE, "2.4", false},
+		{Equals, "2.3.1", true},
+		{Equals, "2.3-1", true},
+		{Equals, "2.3.1.1", false},
+	}
+	for _, tt := range data {
+		fixture := Dep{
+			Version:    suite.versionFixture,
+			Constraint: tt.constraint,
+			Name:       "CatsAndOranges",
+		}
+		suite.Equal(tt.expected, fixture.IsSatisfiedBy(ParseVersion(tt.version)), fmt.Sprintf("%s satisfied by %s", fixture.ToString(), tt.version))
+	}
+}
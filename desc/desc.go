@@ -55,6 +55,7 @@ func NewDesc(d desc) Desc {
 		Description:       d.Description,
 		License:           d.License,
 		MD5sum:            d.MD5sum,
+		SHA256:            d.SHA256,
 		Path:              d.Path,
 		Priority:          d.Priority,
 		Remotes:           d.Remotes,
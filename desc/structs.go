@@ -63,6 +63,7 @@ type Desc struct {
 	Description        string
 	License            string
 	MD5sum             string
+	SHA256             string
 	NeedsCompilation   bool
 	Path               string
 	Priority           string
@@ -106,6 +107,9 @@ type desc struct {
 	Description        string
 	License            string
 	MD5sum             string
+	// SHA256 is not written by tools::write_PACKAGES,
+	// but is published by some repos
+	SHA256             string
 	NeedsCompilation   string
 	// Path: 4.1.0/Recommended
 	// Path: older
@@ -1,16 +1,33 @@
 package desc
 
 import (
-	"regexp"
 	"strconv"
+	"strings"
 )
 
+// splitVersion splits a version into at most 4 components separated by . or -,
+// the last holding the remainder, as regexp.MustCompile(`[\.-]`).Split(v, 4) would
+func splitVersion(v string) []string {
+	parts := make([]string, 0, 4)
+	for len(parts) < 3 {
+		i := strings.IndexAny(v, ".-")
+		if i < 0 {
+			break
+		}
+		parts = append(parts, v[:i])
+		v = v[i+1:]
+	}
+	return append(parts, v)
+}
+
 // ParseVersion parses a package string to a version
 func ParseVersion(v string) Version {
 	ver := Version{String: v}
-	parts := regexp.MustCompile(`[\.-]`).Split(v, 4)
+	parts := splitVersion(v)
 	ver.Major, _ = strconv.Atoi(parts[0])
-	ver.Minor, _ = strconv.Atoi(parts[1])
+	if len(parts) > 1 {
+		ver.Minor, _ = strconv.Atoi(parts[1])
+	}
 	if len(parts) > 2 {
 		ver.Patch, _ = strconv.Atoi(parts[2])
 	}
@@ -2,6 +2,7 @@ package desc
 
 import (
 	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,6 +34,10 @@ func TestVersion(t *testing.T) {
 			"1-2-3-4",
 			Version{1, 2, 3, 4, 0, "1-2-3-4"},
 		},
+		{
+			"1",
+			Version{1, 0, 0, 0, 0, "1"},
+		},
 	}
 	for i, tt := range data {
 		actual := ParseVersion(tt.in)
@@ -80,3 +85,10 @@ func TestComparisonString(t *testing.T) {
 		assert.Equal(tt.expected, actual, fmt.Sprintf("test num: %v", i+1))
 	}
 }
+
+func TestSplitVersion(t *testing.T) {
+	re := regexp.MustCompile(`[\.-]`)
+	for _, v := range []string{"", "1", "1.0", "1.0-2", "0.8.0.1", "1.2.3.4.5", "1..2", "1-2-3-4-5-6", "2.5.1.9000"} {
+		assert.Equal(t, re.Split(v, 4), splitVersion(v), v)
+	}
+}
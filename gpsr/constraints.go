@@ -0,0 +1,127 @@
+package gpsr
+
+import (
+	"fmt"
+
+	"github.com/metrumresearchgroup/pkgr/cran"
+	"github.com/metrumresearchgroup/pkgr/desc"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxConstraintPasses bounds the number of times the dependency graph is rebuilt
+// while settling on package versions that satisfy every version constraint
+const maxConstraintPasses = 10
+
+// buildGraph builds the dependency graph for the requested packages such that every
+// package version selected satisfies the version constraints of the packages depending on it.
+// Selecting a different version (and thus repo) for a package can change its dependencies,
+// so the graph is rebuilt until the set of constraints no longer changes
+func buildGraph(pkgs []string, dependencyConfigs InstallDeps, pkgNexus *cran.PkgNexus) (Graph, error) {
+	// constraints already present, eg set by the user, must always be kept
+	initialConstraints := pkgNexus.Constraints.Copy()
+	for pass := 1; ; pass++ {
+		workingGraph := NewGraph()
+		for _, p := range pkgs {
+			pkgDesc, _, _ := pkgNexus.GetPackage(p)
+			appendToGraph(workingGraph, pkgDesc, dependencyConfigs, pkgNexus)
+		}
+		constraints := initialConstraints.Copy()
+		addGraphConstraints(constraints, workingGraph, dependencyConfigs, pkgNexus)
+		if constraints.Equal(pkgNexus.Constraints) {
+			// only go looking through repo archives once the current
+			// versions of the packages are known not to be sufficient
+			if !resolveArchivedPackages(pkgNexus, workingGraph, dependencyConfigs) {
+				return workingGraph, checkGraphConstraints(pkgNexus)
+			}
+		}
+		if pass == maxConstraintPasses {
+			return workingGraph, fmt.Errorf("could not settle on package versions satisfying all version constraints after %d passes", pass)
+		}
+		log.WithField("pass", pass).Debug("version constraints or available packages changed, rebuilding dependency graph")
+		pkgNexus.Constraints = constraints
+	}
+}
+
+// addGraphConstraints adds the version constraints from every dependency
+// edge that is followed when building the graph
+func addGraphConstraints(constraints cran.PkgConstraints, graph Graph, dependencyConfigs InstallDeps, pkgNexus *cran.PkgNexus) {
+	for pkg := range graph {
+		d, _, ok := pkgNexus.GetPackage(pkg)
+		if !ok {
+			continue
+		}
+		for _, dep := range followedDeps(d, dependencyConfigs) {
+			constraints.Add(dep, pkg)
+		}
+	}
+}
+
+// followedDeps provides the dependencies of a package followed when building the graph
+func followedDeps(d desc.Desc, dependencyConfigs InstallDeps) []desc.Dep {
+	dependencyConfig, exists := dependencyConfigs.Deps[d.Package]
+	if !exists {
+		dependencyConfig = dependencyConfigs.Default
+	}
+	var deps []map[string]desc.Dep
+	if dependencyConfig.Depends {
+		deps = append(deps, d.Depends)
+	}
+	if dependencyConfig.Imports {
+		deps = append(deps, d.Imports)
+	}
+	if dependencyConfig.LinkingTo {
+		deps = append(deps, d.LinkingTo)
+	}
+	var followed []desc.Dep
+	for _, dm := range deps {
+		for r, dep := range dm {
+			// the R version is already accounted for when building the package database
+			if r == "R" || isExcludedPackage(r, dependencyConfig.NoRecommended) {
+				continue
+			}
+			followed = append(followed, dep)
+		}
+	}
+	return followed
+}
+
+// checkGraphConstraints makes sure a version was found for every package that has constraints
+// as a package with no satisfying version would otherwise silently be left out of the graph
+func checkGraphConstraints(pkgNexus *cran.PkgNexus) error {
+	for pkg := range pkgNexus.Constraints {
+		if err := pkgNexus.CheckConstraints(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveArchivedPackages looks up an archived version for every package that has constraints
+// no available version satisfies, and every dependency for which each version available
+// requires a newer version of R, returning whether any additional versions were found
+func resolveArchivedPackages(pkgNexus *cran.PkgNexus, graph Graph, dependencyConfigs InstallDeps) bool {
+	resolved := false
+	for pkg := range pkgNexus.Constraints {
+		if _, _, ok := pkgNexus.GetPackage(pkg); ok {
+			continue
+		}
+		if pkgNexus.ResolveArchivedPackage(pkg) {
+			resolved = true
+		}
+	}
+	for pkg := range graph {
+		d, _, ok := pkgNexus.GetPackage(pkg)
+		if !ok {
+			continue
+		}
+		for _, dep := range followedDeps(d, dependencyConfigs) {
+			if _, constrained := pkgNexus.Constraints[dep.Name]; constrained || !pkgNexus.NeedsNewerR(dep.Name) {
+				continue
+			}
+			if pkgNexus.ResolveArchivedPackage(dep.Name) {
+				resolved = true
+			}
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,156 @@
+package gpsr
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/cran"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepo is a local repo of source packages, with the PACKAGES index given
+type testRepo struct {
+	name     string
+	packages string
+}
+
+// newTestNexus writes each repo to a directory and reads it with cran.NewPkgDb, as any
+// configured local repo is. The repos are provided in order, with the directory of each
+func newTestNexus(t *testing.T, rv cran.RVersion, repos ...testRepo) (*cran.PkgNexus, []string) {
+	// keep the cached repo databases of the test out of the user cache
+	cache, set := os.LookupEnv("XDG_CACHE_HOME")
+	require.NoError(t, os.Setenv("XDG_CACHE_HOME", t.TempDir()))
+	t.Cleanup(func() {
+		if set {
+			os.Setenv("XDG_CACHE_HOME", cache)
+		} else {
+			os.Unsetenv("XDG_CACHE_HOME")
+		}
+	})
+	var urls []cran.RepoURL
+	var dirs []string
+	for _, r := range repos {
+		dir := t.TempDir()
+		contrib := filepath.Join(dir, "src", "contrib")
+		require.NoError(t, os.MkdirAll(contrib, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(contrib, "PACKAGES"), []byte(strings.TrimSpace(r.packages)+"\n"), 0644))
+		urls = append(urls, cran.RepoURL{Name: r.name, URL: dir})
+		dirs = append(dirs, dir)
+	}
+	pkgNexus, err := cran.NewPkgDb(urls, cran.Source, cran.NewInstallConfig(), rv, false)
+	require.NoError(t, err)
+	return pkgNexus, dirs
+}
+
+func TestResolveInstallationReqs_FallsThroughToSatisfyingRepo(t *testing.T) {
+	pkgNexus, _ := newTestNexus(t, cran.RVersion{},
+		testRepo{"internal", `
+Package: dplyr
+Version: 0.8.5
+Imports: rlang
+
+Package: rlang
+Version: 0.4.0
+`},
+		testRepo{"CRAN", `
+Package: dplyr
+Version: 1.0.7
+Imports: rlang (>= 0.4.10)
+
+Package: rlang
+Version: 0.4.11
+
+Package: tidyr
+Version: 1.1.3
+Imports: dplyr (>= 1.0.0)
+`},
+	)
+	ip, err := ResolveInstallationReqs([]string{"tidyr"}, nil, NewDefaultInstallDeps(), pkgNexus, false, false, false)
+	assert.Nil(t, err)
+
+	selected := make(map[string]cran.PkgDl)
+	for _, pd := range ip.PackageDownloads {
+		selected[pd.Package.Package] = pd
+	}
+	assert.Len(t, selected, 3)
+	assert.Equal(t, "1.0.7", selected["dplyr"].Package.Version)
+	assert.Equal(t, "CRAN", selected["dplyr"].Config.Repo.Name)
+	// only required by the newer dplyr, so is only known once dplyr falls through to CRAN
+	assert.Equal(t, "0.4.11", selected["rlang"].Package.Version)
+	assert.Equal(t, "CRAN", selected["rlang"].Config.Repo.Name)
+}
+
+func TestResolveInstallationReqs_UnsatisfiableConstraint(t *testing.T) {
+	pkgNexus, _ := newTestNexus(t, cran.RVersion{},
+		testRepo{"internal", `
+Package: dplyr
+Version: 0.8.5
+`},
+		testRepo{"CRAN", `
+Package: dplyr
+Version: 0.8.3
+
+Package: tidyr
+Version: 1.1.3
+Imports: dplyr (>= 1.0.0)
+`},
+	)
+	_, err := ResolveInstallationReqs([]string{"tidyr"}, nil, NewDefaultInstallDeps(), pkgNexus, false, false, false)
+	assert.IsType(t, &cran.ConstraintError{}, err)
+	assert.Equal(t,
+		"no available version of dplyr satisfies: dplyr (>= 1.0.0) required by tidyr; available versions: 0.8.5 (internal, source), 0.8.3 (CRAN, source)",
+		err.Error(),
+	)
+}
+
+// writeTestArchive writes a minimal archived source package into the archive of the repo at dir
+func writeTestArchive(t *testing.T, dir string, pkg string, version string) {
+	archive := filepath.Join(dir, "src", "contrib", "Archive", pkg)
+	require.NoError(t, os.MkdirAll(archive, 0755))
+	f, err := os.Create(filepath.Join(archive, fmt.Sprintf("%s_%s.tar.gz", pkg, version)))
+	require.NoError(t, err)
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	content := fmt.Sprintf("Package: %s\nVersion: %s\n", pkg, version)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: pkg + "/DESCRIPTION", Mode: 0644, Size: int64(len(content))}))
+	_, err = tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+}
+
+func TestResolveInstallationReqs_DependencyRequiringNewerR(t *testing.T) {
+	pkgNexus, dirs := newTestNexus(t, cran.RVersion{Major: 4, Minor: 1, Patch: 2},
+		testRepo{"CRAN", `
+Package: dplyr
+Version: 1.0.7
+Imports: rlang
+
+Package: rlang
+Version: 1.0.0
+Depends: R (>= 4.2.0)
+`},
+	)
+	writeTestArchive(t, dirs[0], "rlang", "0.4.0")
+
+	ip, err := ResolveInstallationReqs([]string{"dplyr"}, nil, NewDefaultInstallDeps(), pkgNexus, false, false, false)
+	require.NoError(t, err)
+	selected := make(map[string]cran.PkgDl)
+	for _, pd := range ip.PackageDownloads {
+		selected[pd.Package.Package] = pd
+	}
+	require.Contains(t, selected, "rlang")
+	assert.Equal(t, "0.4.0", selected["rlang"].Package.Version)
+	assert.Equal(t, "Archive/rlang", selected["rlang"].Package.Path)
+	newer, ok := pkgNexus.RVersionDowngrade("rlang", selected["rlang"].Package)
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0 (CRAN, source, requires R (>= 4.2.0))", newer)
+}
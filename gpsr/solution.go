@@ -20,7 +20,6 @@ func ResolveInstallationReqs(
 	noRecommended bool,
 ) (InstallPlan, error) {
 
-	workingGraph := NewGraph()
 	defaultDependencyConfigs := NewDefaultInstallDeps()
 
 	// if globally noRecommended different than default, lets set it to that
@@ -33,9 +32,9 @@ func ResolveInstallationReqs(
 	}
 	depDb := make(map[string][]string)
 
-	for _, p := range pkgs {
-		pkgDesc, _, _ := pkgNexus.GetPackage(p)
-		appendToGraph(workingGraph, pkgDesc, dependencyConfigs, pkgNexus)
+	workingGraph, err := buildGraph(pkgs, dependencyConfigs, pkgNexus)
+	if err != nil {
+		return InstallPlan{}, err
 	}
 	resolved, err := ResolveLayers(workingGraph, noRecommended)
 	if err != nil {
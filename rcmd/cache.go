@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/metrumresearchgroup/pkgr/cran"
+	"github.com/spf13/afero"
 )
 
 //NewPackageCache provides a PackageCache, optionally forcing that
@@ -22,3 +25,13 @@ func NewPackageCache(dir string, mustWork bool) PackageCache {
 	}
 	return PackageCache{BaseDir: dir}
 }
+
+// builtBinaryPath provides where the binary built from the source tarball at src is kept
+// in the package store, so it is shared by every repo providing the identical tarball
+func builtBinaryPath(fs afero.Fs, pc PackageCache, src string, rs RSettings) (string, error) {
+	sum, err := cran.FileMD5(fs, src)
+	if err != nil {
+		return "", err
+	}
+	return cran.NewPackageStore(fs, pc.BaseDir).BuiltPath(sum, rs.Version.ToString(), rs.Platform), nil
+}
@@ -65,7 +65,7 @@ func configureEnv(sysEnvVars []string, rs RSettings, pkg string) []string {
 			_, exists := envList.Get(evs[0])
 			if !exists {
 				displayValue := evs[1]
-				censoredVars := censoredEnvVars(nil)
+				censoredVars := censoredEnvVars(rs.CensoredEnvVars)
 				_, isCensored := censoredVars[strings.ToUpper(evs[0])]
 
 				if isCensored {
@@ -196,6 +196,30 @@ func TestConfigureArgs2(t *testing.T) {
 	}
 }
 
+func TestConfigureArgsCensoredRepoCredentials(t *testing.T) {
+	rs := RSettings{
+		LibPaths:        []string{"path/to/install/lib"},
+		PkgEnvVars:      make(map[string]map[string]string),
+		CensoredEnvVars: []string{"MYREPO_TOKEN"},
+	}
+	tt := configureArgsTestCase{
+		"Repo credentials are hidden",
+		"",
+		[]string{
+			"MYREPO_TOKEN=should_get_hidden",
+			"OTHER_VAR=visible",
+		},
+		[]string{
+			"MYREPO_TOKEN=**HIDDEN**",
+			"OTHER_VAR=visible",
+			"R_LIBS_SITE=path/to/install/lib",
+			"R_LIBS_USER=SHOULD_BE_TMP_DIR",
+		},
+	}
+	actual := configureEnv(tt.sysEnv, rs, tt.in)
+	checkEnvVarsValid(t, tt, actual)
+}
+
 func TestCensoredEnvVars(t *testing.T) {
 	tests := map[string]struct {
 		additionalVars []string
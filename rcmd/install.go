@@ -238,7 +238,18 @@ func isInCache(
 		ir.RSettings.Version.ToString(),
 		binaryName(pkg.Package, pkg.Version, ir.RSettings.Platform),
 	)
+	if meta.Metadata.Config.Type == cran.Binary && meta.Metadata.Config.Repo.BinaryURL != "" && meta.Path != "" {
+		// binaries downloaded by name of the source package, such as from
+		// Posit Package Manager, do not follow the platform naming
+		bpath = meta.Path
+	}
 	exists, err := goutils.Exists(fs, bpath)
+	if !exists && meta.Metadata.Config.Type != cran.Binary && meta.Path != "" {
+		// the same source tarball may have been built when resolved from another repo
+		if obj, serr := builtBinaryPath(fs, pc, meta.Path, ir.RSettings); serr == nil {
+			exists, err = cran.NewPackageStore(fs, pc.BaseDir).Link(obj, bpath)
+		}
+	}
 	if !exists || err != nil {
 		log.WithFields(log.Fields{
 			"path":    bpath,
@@ -250,6 +261,7 @@ func isInCache(
 		"path":    bpath,
 		"package": pkg.Package,
 	}).Trace("found in cache")
+	cran.TouchCached(fs, bpath)
 	ir.Metadata.Path = bpath
 	ir.Metadata.Metadata.Config.Type = cran.Binary
 	return true, ir
@@ -438,12 +450,17 @@ func InstallPackagePlan(
 
 				if iu.Result.ExitCode != -999 {
 					packagesNeeded = packagesNeeded - 1
-					log.WithFields(log.Fields{
+					fields := log.Fields{
 						"package":   iu.Package,
 						"version":   pkg.Metadata.Package.Version,
 						"repo":      pkg.Metadata.Config.Repo.Name,
 						"remaining": packagesNeeded,
-					}).Info("Successfully Installed.")
+					}
+					// note which mirror served the package for repos with more than one
+					if pkg.Mirror != "" && len(pkg.Metadata.Config.Repo.Mirrors) > 0 {
+						fields["mirror"] = pkg.Mirror
+					}
+					log.WithFields(fields).Info("Successfully Installed.")
 				}
 				installedPkgs[iu.Package] = true
 				deps, exists := iDeps[iu.Package]
@@ -484,6 +501,11 @@ func InstallPackagePlan(
 						log.WithFields(log.Fields{"from": iu.BinaryPath, "to": bpath}).Error("error copying binary")
 						return
 					}
+					if obj, err := builtBinaryPath(fs, pc, pkg.Path, rs); err == nil {
+						if err := cran.NewPackageStore(fs, pc.BaseDir).Add(obj, bpath); err != nil {
+							log.WithFields(log.Fields{"binary": bpath, "error": err}).Warn("could not add binary to the package store")
+						}
+					}
 					// want to delete binaries from the existing tmpdir
 					// so do not carry around two copies. This is especially
 					// relevant for containerized environment where layers get snapshotted
@@ -2,8 +2,14 @@ package rcmd
 
 import (
 	"fmt"
-	"github.com/stretchr/testify/assert"
+	"path/filepath"
 	"testing"
+
+	"github.com/metrumresearchgroup/pkgr/cran"
+	"github.com/metrumresearchgroup/pkgr/desc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInstallArgs(t *testing.T) {
@@ -142,3 +148,62 @@ func TestUpdateDescriptionInfoByLines_RepoTheSame(t *testing.T) {
 
 	}
 }
+
+func TestIsInCacheSharedAcrossRepos(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	pc := PackageCache{BaseDir: "/cache"}
+	rs := RSettings{Version: cran.RVersion{Major: 4, Minor: 2}, Platform: "x86_64-pc-linux-gnu"}
+	request := func(repo cran.RepoURL) InstallRequest {
+		d := cran.PkgDl{Package: desc.Desc{Package: "R6", Version: "2.5.0"}, Config: cran.PkgConfig{Repo: repo, Type: cran.Source}}
+		src := filepath.Join(pc.BaseDir, cran.RepoURLHash(repo), "src", "R6_2.5.0.tar.gz")
+		require.NoError(t, afero.WriteFile(fs, src, []byte("R6 tarball"), 0644))
+		return InstallRequest{Package: "R6", Metadata: cran.Download{Path: src, Metadata: d}, Cache: pc, RSettings: rs}
+	}
+	cranReq := request(cran.RepoURL{Name: "CRAN", URL: "https://cran.invalid"})
+	mpnReq := request(cran.RepoURL{Name: "MPN", URL: "https://mpn.invalid/2022-06-15"})
+
+	found, _ := isInCache(fs, mpnReq, pc)
+	assert.False(t, found)
+
+	// a binary built when installing from one repo is stored by the checksum of its source
+	bpath := filepath.Join(pc.BaseDir, cran.RepoURLHash(cranReq.Metadata.Metadata.Config.Repo), "binary", "4.2", binaryName("R6", "2.5.0", rs.Platform))
+	require.NoError(t, afero.WriteFile(fs, bpath, []byte("R6 binary"), 0644))
+	obj, err := builtBinaryPath(fs, pc, cranReq.Metadata.Path, rs)
+	require.NoError(t, err)
+	require.NoError(t, cran.NewPackageStore(fs, pc.BaseDir).Add(obj, bpath))
+
+	found, ir := isInCache(fs, mpnReq, pc)
+	require.True(t, found)
+	assert.Equal(t, cran.Binary, ir.Metadata.Metadata.Config.Type)
+	binary, err := afero.ReadFile(fs, ir.Metadata.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "R6 binary", string(binary))
+}
+
+func TestIsInCacheBinaryPath(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	pc := PackageCache{BaseDir: "/cache"}
+	rs := RSettings{Version: cran.RVersion{Major: 4, Minor: 2}, Platform: "x86_64-pc-linux-gnu"}
+	tests := map[string]struct {
+		repo     cran.RepoURL
+		expected string
+	}{
+		"repo serving binaries by source name": {
+			repo:     cran.RepoURL{Name: "PPM", URL: "https://ppm.invalid/cran/latest", BinaryURL: "https://ppm.invalid/cran/__linux__/jammy/latest"},
+			expected: "/downloaded/R6_2.5.0.tar.gz",
+		},
+		"cran binary": {
+			repo: cran.RepoURL{Name: "CRAN", URL: "https://cran.invalid"},
+		},
+	}
+	require.NoError(t, afero.WriteFile(fs, "/downloaded/R6_2.5.0.tar.gz", []byte("R6 binary"), 0644))
+	for name, tt := range tests {
+		d := cran.PkgDl{Package: desc.Desc{Package: "R6", Version: "2.5.0"}, Config: cran.PkgConfig{Repo: tt.repo, Type: cran.Binary}}
+		ir := InstallRequest{Package: "R6", Metadata: cran.Download{Path: "/downloaded/R6_2.5.0.tar.gz", Metadata: d}, Cache: pc, RSettings: rs}
+		found, ir := isInCache(fs, ir, pc)
+		assert.Equal(t, tt.expected != "", found, name)
+		if tt.expected != "" {
+			assert.Equal(t, tt.expected, ir.Metadata.Path, name)
+		}
+	}
+}
@@ -27,6 +27,9 @@ type RSettings struct {
 	GlobalEnvVars NvpList                      `json:"global_env_vars,omitempty"`
 	PkgEnvVars    map[string]map[string]string `json:"pkg_env_vars,omitempty"`
 	Platform      string                       `json:"platform,omitempty"`
+	// CensoredEnvVars are additional environment variables, such as repo
+	// credentials, whose values must never be logged
+	CensoredEnvVars []string `json:"censored_env_vars,omitempty"`
 }
 
 // InstallArgs represents the installation arguments R CMD INSTALL can consume